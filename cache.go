@@ -0,0 +1,83 @@
+package xt
+
+import (
+	"container/list"
+	"sync"
+)
+
+// templateCache is a least recently used cache of parsed templates
+type templateCache struct {
+	mu    sync.Mutex
+	size  int // maximum number of templates, 0 disables the cache and < 0 is unlimited
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// cacheEntry is a single template in the cache
+type cacheEntry struct {
+	name string
+	tree *Tree
+}
+
+// newTemplateCache creates a cache holding at most size templates
+func newTemplateCache(size int) *templateCache {
+	return &templateCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the template called name, if it is in the cache
+func (c *templateCache) get(name string) (*Tree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[name]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry).tree, true
+}
+
+// add adds a template to the cache, removing the least recently used
+// template if the cache is full
+func (c *templateCache) add(name string, t *Tree) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size == 0 {
+		return
+	}
+	if el, ok := c.items[name]; ok {
+		el.Value.(*cacheEntry).tree = t
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[name] = c.ll.PushFront(&cacheEntry{name: name, tree: t})
+	c.evict()
+}
+
+// resize changes the maximum number of templates in the cache
+func (c *templateCache) resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict()
+}
+
+// clear removes all templates from the cache
+func (c *templateCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// evict removes the least recently used templates until the cache is within its size
+func (c *templateCache) evict() {
+	for c.size >= 0 && c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).name)
+	}
+}
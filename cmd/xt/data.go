@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readData reads the data file name, or standard input if name is '-'.
+// The format is decided by the extension of the file, or by format
+// when reading from standard input.
+func readData(name, format string) (map[string]interface{}, error) {
+	var src []byte
+	var err error
+	if name == "-" {
+		name = "<stdin>"
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeData(src, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return data, nil
+}
+
+// decodeData decodes src in the given format. The top level value must be a mapping.
+func decodeData(src []byte, format string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(src))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return nil, err
+		}
+		convertNumbers(data)
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(src, &data); err != nil {
+			return nil, err
+		}
+	case "toml":
+		if err := toml.Unmarshal(src, &data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown data format '%s'", format)
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return data, nil
+}
+
+// convertNumbers replaces the json.Number values in val with int64 or float64 values,
+// so that integers in JSON data are printed and compared as integers
+func convertNumbers(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	case []interface{}:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	}
+	return val
+}
+
+// setValue sets a value in data from an assignment in the form 'key=value'.
+// The key may contain dots to set nested values, e.g. 'server.port=8080'.
+// Values that are valid JSON are decoded as JSON, other values are used as strings.
+func setValue(data map[string]interface{}, assignment string) error {
+	key, text, ok := strings.Cut(assignment, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("--set %s: expected key=value", assignment)
+	}
+
+	var value interface{} = text
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err == nil && !dec.More() {
+		value = convertNumbers(v)
+	}
+
+	keys := strings.Split(key, ".")
+	for _, k := range keys[:len(keys)-1] {
+		if k == "" {
+			return fmt.Errorf("--set %s: empty key", assignment)
+		}
+		m, ok := data[k].(map[string]interface{})
+		if !ok {
+			m = make(map[string]interface{})
+			data[k] = m
+		}
+		data = m
+	}
+	if keys[len(keys)-1] == "" {
+		return fmt.Errorf("--set %s: empty key", assignment)
+	}
+	data[keys[len(keys)-1]] = value
+	return nil
+}
+
+// environ returns the environment variables as a map
+func environ() map[string]interface{} {
+	env := make(map[string]interface{})
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
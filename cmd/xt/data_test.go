@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeData(t *testing.T) {
+	tests := []struct {
+		format string
+		src    string
+		want   map[string]interface{}
+		err    string
+	}{
+		{"json", `{"a": 1, "b": 1.5, "c": [1, "x"], "d": {"e": true}}`, map[string]interface{}{
+			"a": int64(1), "b": 1.5, "c": []interface{}{int64(1), "x"}, "d": map[string]interface{}{"e": true},
+		}, ""},
+		{"json", `null`, map[string]interface{}{}, ""},
+		{"yaml", "a: 1\nb: [x, y]\n", map[string]interface{}{"a": 1, "b": []interface{}{"x", "y"}}, ""},
+		{"yml", "", map[string]interface{}{}, ""},
+		{"toml", "a = 1\n[b]\nc = \"x\"\n", map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": "x"}}, ""},
+		{"json", `[1, 2]`, nil, "cannot unmarshal array"},
+		{"json", `{`, nil, "unexpected EOF"},
+		{"yaml", "- 1\n", nil, "cannot unmarshal"},
+		{"xml", "<a/>", nil, "unknown data format 'xml'"},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			got, err := decodeData([]byte(test.src), test.format)
+			switch {
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case !reflect.DeepEqual(got, test.want):
+				t.Fatalf("expected %#v, got %#v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	data := map[string]interface{}{
+		"server": map[string]interface{}{"host": "localhost"},
+		"name":   "x",
+	}
+	for _, s := range []string{
+		"server.port=8080",
+		"debug=true",
+		"title=hello world",
+		"list=[1, \"a\"]",
+		"name.first=y",
+		"empty=",
+		"eq=a=b",
+		"partial=1 2",
+	} {
+		if err := setValue(data, s); err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+	}
+	want := map[string]interface{}{
+		"server":  map[string]interface{}{"host": "localhost", "port": int64(8080)},
+		"debug":   true,
+		"title":   "hello world",
+		"list":    []interface{}{int64(1), "a"},
+		"name":    map[string]interface{}{"first": "y"},
+		"empty":   "",
+		"eq":      "a=b",
+		"partial": "1 2",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("expected %#v, got %#v", want, data)
+	}
+
+	for _, s := range []string{"novalue", "=1", "a..b=1", "a.=1"} {
+		if err := setValue(data, s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/yzzyx/xt"
+)
+
+const dumpUsage = `usage: xt dump [flags] [template]
+
+Print the parse tree of a template, or the tokens produced by the lexer
+if -tokens is given. The template is read from the given file, or from
+standard input if no file is given or the name is '-'.
+
+The output is an indented tree, or JSON if -json is given. Each node is
+printed with its type, the line and column where it starts, and its fields.
+Included and extended templates are not loaded. Templates ending with
+.html, .htm or .xml are autoescaped, as with 'xt render'.
+
+flags:
+`
+
+var (
+	nodeType     = reflect.TypeOf((*xt.Node)(nil)).Elem()
+	nodeListType = reflect.TypeOf([]xt.Node(nil))
+	posType      = reflect.TypeOf(xt.Pos(0))
+)
+
+// runDump implements 'xt dump'
+func runDump(args []string) error {
+	var syntax syntaxFlags
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), dumpUsage)
+		fs.PrintDefaults()
+	}
+	tokens := fs.Bool("tokens", false, "print the tokens instead of the parse tree")
+	asJSON := fs.Bool("json", false, "print the output as JSON")
+	syntax.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(fs.Output(), "xt dump: only one template can be dumped")
+		fs.Usage()
+		return errUsage
+	}
+
+	name := "-"
+	if fs.NArg() == 1 {
+		name = fs.Arg(0)
+	}
+	var src []byte
+	var err error
+	if name == "-" {
+		name = "<stdin>"
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	env := xt.NewEnvironment()
+	env.SetAutoescape(xt.AutoescapeExtensions())
+	if err = syntax.apply(env); err != nil {
+		return err
+	}
+
+	if *tokens {
+		toks := env.Tokens(name, string(src))
+		if *asJSON {
+			return writeJSON(os.Stdout, toks)
+		}
+		for _, tok := range toks {
+			fmt.Printf("%d:%d\t%-12s %s\n", tok.Line, tok.Col, tok.Type, strconv.Quote(tok.Value))
+		}
+		if last := toks[len(toks)-1]; last.Type == "error" {
+			return fmt.Errorf("%s:%d:%d: %s", name, last.Line, last.Col, last.Value)
+		}
+		return nil
+	}
+
+	t := env.NewTree(name)
+	if err = t.Parse(string(src)); err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(os.Stdout, jsonNodeList(t, t.Root))
+	}
+	var buf bytes.Buffer
+	dumpNodeList(&buf, t, t.Root, 0)
+	_, err = buf.WriteTo(os.Stdout)
+	return err
+}
+
+// dumpNodeList writes the nodes in list as an indented tree
+func dumpNodeList(buf *bytes.Buffer, t *xt.Tree, list []xt.Node, depth int) {
+	for _, n := range list {
+		dumpNode(buf, t, n, depth)
+	}
+}
+
+// dumpNode writes the node n, followed by its child nodes, indented one level deeper
+func dumpNode(buf *bytes.Buffer, t *xt.Tree, n xt.Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	v := reflect.Indirect(reflect.ValueOf(n))
+	line, col := t.Location(n.Position())
+	fmt.Fprintf(buf, "%s%s %d:%d", indent, v.Type().Name(), line, col)
+
+	// print the plain fields on the same line as the node, and the child nodes below it
+	var children []int
+	for k := 0; k < v.NumField(); k++ {
+		f := v.Type().Field(k)
+		switch {
+		case !f.IsExported() || f.Type == posType:
+		case f.Type == nodeType || f.Type == nodeListType:
+			children = append(children, k)
+		case f.Type.Kind() == reflect.String:
+			fmt.Fprintf(buf, " %s=%s", f.Name, strconv.Quote(v.Field(k).String()))
+		default:
+			fmt.Fprintf(buf, " %s=%v", f.Name, v.Field(k).Interface())
+		}
+	}
+	buf.WriteByte('\n')
+
+	for _, k := range children {
+		field := v.Field(k)
+		if field.IsNil() {
+			continue
+		}
+		fmt.Fprintf(buf, "%s  %s:\n", indent, v.Type().Field(k).Name)
+		if list, ok := field.Interface().([]xt.Node); ok {
+			dumpNodeList(buf, t, list, depth+2)
+		} else {
+			dumpNode(buf, t, field.Interface().(xt.Node), depth+2)
+		}
+	}
+}
+
+// jsonObject is a JSON object which keeps the order of its fields
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+// MarshalJSON implements json.Marshaler
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for k, f := range o {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSON(&buf, f.name); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := encodeJSON(&buf, f.value); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonNodeList converts the nodes in list to JSON objects
+func jsonNodeList(t *xt.Tree, list []xt.Node) []interface{} {
+	res := make([]interface{}, len(list))
+	for k, n := range list {
+		res[k] = jsonNode(t, n)
+	}
+	return res
+}
+
+// jsonNode converts the node n to a JSON object, with the fields 'type', 'pos',
+// 'line' and 'col', followed by the fields of the node
+func jsonNode(t *xt.Tree, n xt.Node) interface{} {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(n))
+	line, col := t.Location(n.Position())
+	obj := jsonObject{
+		{"type", v.Type().Name()},
+		{"pos", n.Position()},
+		{"line", line},
+		{"col", col},
+	}
+	for k := 0; k < v.NumField(); k++ {
+		f := v.Type().Field(k)
+		switch {
+		case !f.IsExported() || f.Type == posType:
+		case f.Type == nodeType:
+			node, _ := v.Field(k).Interface().(xt.Node)
+			obj = append(obj, jsonField{f.Name, jsonNode(t, node)})
+		case f.Type == nodeListType:
+			obj = append(obj, jsonField{f.Name, jsonNodeList(t, v.Field(k).Interface().([]xt.Node))})
+		default:
+			obj = append(obj, jsonField{f.Name, v.Field(k).Interface()})
+		}
+	}
+	return obj
+}
+
+// encodeJSON appends val to buf as JSON, without escaping HTML characters
+func encodeJSON(buf *bytes.Buffer, val interface{}) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // remove the newline added by Encode
+	return nil
+}
+
+// writeJSON writes val to w as indented JSON
+func writeJSON(w io.Writer, val interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(val)
+}
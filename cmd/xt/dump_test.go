@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout runs fn with standard output redirected to a file,
+// and returns what was written
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stdout := os.Stdout
+	os.Stdout = f
+	err = fn()
+	os.Stdout = stdout
+
+	out, rerr := os.ReadFile(f.Name())
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(out), err
+}
+
+func TestDump(t *testing.T) {
+	quiet(t)
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"loop.txt":    "{% for x in y %}{{ x.a }}{% endfor %}",
+		"var.txt":     "a{{ x }}",
+		"escape.html": "{{ x }}",
+		"delims.txt":  "<% if x %>a<% endif %>",
+		"broken.txt":  "{% if %}",
+		"lexer.txt":   "{{ 'a }}",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  string
+	}{
+		{"tree", []string{path("loop.txt")}, `ForStmt 1:4 Vars=[x] Lookahead=false Collect=false
+  Seq:
+    Identifier 1:13 Name="y"
+  Body:
+    VarStmt 1:17 Escapers=[]
+      Expression:
+        AttrExpr 1:20 Name="a"
+          X:
+            Identifier 1:20 Name="x"
+`, ""},
+		{"autoescape", []string{path("escape.html")}, `VarStmt 1:1 Escapers=[html]
+  Expression:
+    Identifier 1:4 Name="x"
+`, ""},
+		{"delimiters", []string{"-delims", "<% %> <%= %>", path("delims.txt")}, `IfStmt 1:4
+  Expression:
+    Identifier 1:7 Name="x"
+  Body:
+    TextValue 1:11 Text="a"
+`, ""},
+		{"tokens", []string{"-tokens", path("var.txt")}, `1:1	text         "a"
+1:2	var-start    "{{"
+1:5	identifier   "x"
+1:7	var-end      "}}"
+1:9	EOF          ""
+`, ""},
+		{"syntax error", []string{path("broken.txt")}, "", "broken.txt:1:7:"},
+		{"token error", []string{"-tokens", path("lexer.txt")}, "", "lexer.txt:1:4: unterminated quoted string"},
+		{"two templates", []string{path("var.txt"), path("loop.txt")}, "", "invalid usage"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := captureStdout(t, func() error { return runDump(test.args) })
+			switch {
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.err == "" && got != test.want:
+				t.Fatalf("expected:\n%s\ngot:\n%s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{"var.txt": "a{{ x < 1 }}"})
+	out, err := captureStdout(t, func() error { return runDump([]string{"-json", filepath.Join(dir, "var.txt")}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"Op": "<"`) {
+		t.Errorf("expected HTML characters to be unescaped, got:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "[\n  {\n    \"type\": \"TextValue\",\n    \"pos\": 0,\n    \"line\": 1,\n    \"col\": 1,") {
+		t.Errorf("expected the fields type, pos, line and col first, got:\n%s", out)
+	}
+
+	var nodes []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[1]["type"] != "VarStmt" {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	expr, _ := nodes[1]["Expression"].(map[string]interface{})
+	if expr["type"] != "BinaryExpr" || expr["col"] != float64(5) {
+		t.Fatalf("unexpected expression: %v", expr)
+	}
+
+	out, err = captureStdout(t, func() error { return runDump([]string{"-json", "-tokens", filepath.Join(dir, "var.txt")}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &tokens); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 7 || tokens[0]["type"] != "text" || tokens[6]["type"] != "EOF" {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yzzyx/xt"
+)
+
+const lintUsage = `usage: xt lint [flags] [template ...]
+
+Check templates for syntax errors. The templates are read from the given
+files, or from standard input if no file is given or the name is '-'.
+
+All errors found in a template are printed, with the offending line of the
+template. Parsing continues after the end of the tag or variable containing
+an error, so an error may cause further errors, e.g. an 'endif'-tag without
+a matching if-statement. Included and extended templates are not checked.
+
+flags:
+`
+
+// runLint implements 'xt lint'
+func runLint(args []string) error {
+	var syntax syntaxFlags
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), lintUsage)
+		fs.PrintDefaults()
+	}
+	syntax.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+
+	env := xt.NewEnvironment()
+	env.SetAutoescape(xt.AutoescapeExtensions())
+	if err := syntax.apply(env); err != nil {
+		return err
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	count := 0
+	for _, name := range names {
+		var src []byte
+		var err error
+		if name == "-" {
+			name = "<stdin>"
+			src, err = io.ReadAll(os.Stdin)
+		} else {
+			src, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return err
+		}
+
+		var list xt.ErrorList
+		if err = env.NewTree(name).ParseAll(string(src)); errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Println(e)
+				if snippet := e.Snippet(); snippet != "" {
+					fmt.Println(snippet)
+				}
+			}
+			count += len(list)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	switch count {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("1 error found")
+	}
+	return fmt.Errorf("%d errors found", count)
+}
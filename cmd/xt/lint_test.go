@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"ok.txt":     "{% if x %}{{ x }}{% endif %}",
+		"one.txt":    "a\n{{ x y }}",
+		"two.txt":    "{% nosuchtag %}\n{{ ) }}",
+		"delims.txt": "<% if x %><% endif %>",
+		"endif.txt":  "{% if x %}a{% endif %",
+		"endfor.txt": "{% for x in y %}{% endfor",
+		"block.txt":  "{% block b %}{% endblock %",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name string
+		args []string
+		want []string // lines expected in the output
+		err  string
+	}{
+		{"no errors", []string{path("ok.txt")}, nil, ""},
+		{"one error", []string{path("one.txt")}, []string{"one.txt:2:6: ", "{{ x y }}", "     ^"}, "1 error found"},
+		{"two errors", []string{path("two.txt")}, []string{"two.txt:1:4: unknown tag nosuchtag", "two.txt:2:4: "}, "2 errors found"},
+		{"several files", []string{path("ok.txt"), path("one.txt"), path("two.txt")}, []string{"one.txt:2:6", "two.txt:1:4", "two.txt:2:4"}, "3 errors found"},
+		{"delimiters", []string{"-delims", "<% %> <%= %>", path("delims.txt")}, nil, ""},
+		{"incomplete end tags", []string{path("endif.txt"), path("endfor.txt"), path("block.txt")}, []string{
+			"endif.txt:1:22: unclosed action", "endfor.txt:1:26: unclosed action", "block.txt:1:27: unclosed action",
+		}, "3 errors found"},
+		{"missing file", []string{path("missing.txt")}, nil, "no such file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error { return runLint(test.args) })
+			switch {
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, line := range test.want {
+				if !strings.Contains(out, line) {
+					t.Errorf("expected output containing %q, got:\n%s", line, out)
+				}
+			}
+			if test.want == nil && out != "" {
+				t.Errorf("expected no output, got:\n%s", out)
+			}
+		})
+	}
+}
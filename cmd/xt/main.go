@@ -0,0 +1,103 @@
+// Command xt renders templates from the command line.
+//
+// Usage:
+//
+//  xt <command> [flags] [arguments]
+//
+// The commands are:
+//
+//  render   render a template with data from JSON, YAML or TOML files
+//  dump     print the tokens or the parse tree of a template
+//  lint     check templates for syntax errors
+//
+// Run 'xt <command> -h' for the flags of a command.
+//
+// xt exits with status 0 on success, 1 if a template or data file could not
+// be loaded, parsed or rendered, or if lint finds errors, and 2 if the
+// command line is invalid.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yzzyx/xt"
+)
+
+// errUsage is returned by commands when the command line is invalid
+// and the usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+// command is a subcommand of xt
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"render", "render a template with data from JSON, YAML or TOML files", runRender},
+	{"dump", "print the tokens or the parse tree of a template", runDump},
+	{"lint", "check templates for syntax errors", runLint},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: xt <command> [flags] [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'xt <command> -h' for the flags of a command\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		switch {
+		case err == nil:
+		case errors.Is(err, flag.ErrHelp):
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		default:
+			fmt.Fprintln(os.Stderr, "xt:", err)
+			// show where in the template the error is
+			var terr *xt.TemplateError
+			if errors.As(err, &terr) && terr.Snippet() != "" {
+				fmt.Fprintln(os.Stderr, terr.Snippet())
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "xt: unknown command '%s'\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// listFlag is a flag that can be given multiple times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
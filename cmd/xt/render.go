@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/yzzyx/xt"
+)
+
+const renderUsage = `usage: xt render [flags] [template]
+
+Render a template, and write the result to standard output or to the file
+given with -o. The template is read from the file given with -t, or as the
+only argument. If no template is given, or the name is '-', the template
+is read from standard input.
+
+Data is read from the files given with -d, which are merged in the order
+given. The format of a data file is decided by its extension (.json,
+.yaml, .yml or .toml), or by -format when reading data from standard input.
+Values given with --set override values from the data files. Nested values
+are set by separating the keys with dots, e.g. --set server.port=8080.
+Values that are valid JSON are parsed as JSON, anything else is used as
+a string.
+
+Included and extended templates are looked up in the directories given
+with -I, in order. The default is the directory of the template.
+
+Variables in templates ending with .html, .htm or .xml are HTML-escaped,
+unless marked as safe or disabled with '{% autoescape false %}'.
+
+flags:
+`
+
+// runRender implements 'xt render'
+func runRender(args []string) error {
+	var dataFiles, sets, searchPath listFlag
+	var syntax syntaxFlags
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), renderUsage)
+		fs.PrintDefaults()
+	}
+	tmplName := fs.String("t", "", "template `file` to render, '-' for standard input")
+	output := fs.String("o", "", "write the output to `file` instead of standard output")
+	format := fs.String("format", "json", "`format` of data read from standard input: json, yaml or toml")
+	withEnv := fs.Bool("env", false, "make the environment variables available as the variable 'env'")
+	fs.Var(&dataFiles, "d", "read data from `file`, '-' for standard input (can be repeated)")
+	fs.Var(&sets, "set", "set the variable `key=value` (can be repeated)")
+	fs.Var(&searchPath, "I", "look up included templates in `dir` (can be repeated)")
+	syntax.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+
+	switch {
+	case fs.NArg() > 1, fs.NArg() == 1 && *tmplName != "":
+		fmt.Fprintln(fs.Output(), "xt render: only one template can be rendered")
+		fs.Usage()
+		return errUsage
+	case fs.NArg() == 1:
+		*tmplName = fs.Arg(0)
+	case *tmplName == "":
+		*tmplName = "-"
+	}
+
+	stdinUsed := *tmplName == "-"
+	data := make(map[string]interface{})
+	for _, name := range dataFiles {
+		if name == "-" {
+			if stdinUsed {
+				fmt.Fprintln(fs.Output(), "xt render: standard input can only be read once")
+				return errUsage
+			}
+			stdinUsed = true
+		}
+		values, err := readData(name, *format)
+		if err != nil {
+			return err
+		}
+		for k, v := range values {
+			data[k] = v
+		}
+	}
+	for _, s := range sets {
+		if err := setValue(data, s); err != nil {
+			return err
+		}
+	}
+	if *withEnv {
+		data["env"] = environ()
+	}
+
+	env := xt.NewEnvironment()
+	env.SetAutoescape(xt.AutoescapeExtensions())
+	if err := syntax.apply(env); err != nil {
+		return err
+	}
+	t, err := parseTemplate(env, *tmplName, searchPath)
+	if err != nil {
+		return err
+	}
+
+	// render to a buffer, so that the output file is left untouched on errors
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	if *output == "" || *output == "-" {
+		_, err = buf.WriteTo(os.Stdout)
+		return err
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0o644)
+}
+
+// parseTemplate reads and parses the template in the file name, or from standard
+// input if name is '-'. Other templates are loaded from the directories in searchPath.
+func parseTemplate(env *xt.Environment, name string, searchPath []string) (*xt.Tree, error) {
+	var src []byte
+	var err error
+	if name == "-" {
+		name = "<stdin>"
+		src, err = io.ReadAll(os.Stdin)
+		if len(searchPath) == 0 {
+			searchPath = []string{"."}
+		}
+	} else {
+		src, err = os.ReadFile(name)
+		if len(searchPath) == 0 {
+			searchPath = []string{filepath.Dir(name)}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	env.SetLoader(xt.NewFileSystemLoader(searchPath...))
+	t := env.NewTree(name)
+	if err = t.Parse(string(src)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
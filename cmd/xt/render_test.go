@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yzzyx/xt"
+)
+
+// writeFiles creates the files in dir, and returns dir
+func writeFiles(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	for name, src := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// quiet discards the output written to standard error until the end of the test,
+// e.g. the usage printed on invalid flags
+func quiet(t *testing.T) {
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = f
+	t.Cleanup(func() {
+		os.Stderr = stderr
+		f.Close()
+	})
+}
+
+func TestRender(t *testing.T) {
+	quiet(t)
+	dir := writeFiles(t, t.TempDir(), map[string]string{
+		"page.html":      "{% extends 'base.html' %}{% block body %}{{ user.name }} {{ n + 1 }}{% endblock %}",
+		"base.html":      "<p>{% block body %}{% endblock %}</p>",
+		"lib/base.html":  "<div>{% block body %}{% endblock %}</div>",
+		"plain.txt":      "{{ '<b>' }} {{ title }}",
+		"broken.txt":     "line 1\n{% if %}",
+		"fail.txt":       "{{ 1 / 0 }}",
+		"data.json":      `{"user": {"name": "<Ann>"}, "n": 1}`,
+		"more.yaml":      "n: 2\ntitle: yaml",
+		"settings.toml":  "title = \"toml\"",
+		"bad.json":       `{"n": `,
+		"unknown.format": "",
+	})
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  string
+	}{
+		{"json data", []string{"-d", path("data.json"), path("page.html")}, "<p>&lt;Ann&gt; 2</p>", ""},
+		{"merged data", []string{"-d", path("data.json"), "-d", path("more.yaml"), path("page.html")}, "<p>&lt;Ann&gt; 3</p>", ""},
+		{"set", []string{"-d", path("data.json"), "--set", "n=41", "--set", "user.name=Bo", "-t", path("page.html")}, "<p>Bo 42</p>", ""},
+		{"search path", []string{"-d", path("data.json"), "-I", path("lib"), path("page.html")}, "<div>&lt;Ann&gt; 2</div>", ""},
+		{"no autoescape", []string{"-d", path("settings.toml"), path("plain.txt")}, "<b> toml", ""},
+
+		{"syntax error", []string{path("broken.txt")}, "", "broken.txt:2:"},
+		{"runtime error", []string{path("fail.txt")}, "", "fail.txt:1:"},
+		{"bad data", []string{"-d", path("bad.json"), path("plain.txt")}, "", "bad.json: unexpected EOF"},
+		{"unknown format", []string{"-d", path("unknown.format"), path("plain.txt")}, "", "unknown data format 'format'"},
+		{"missing template", []string{path("missing.txt")}, "", "no such file"},
+		{"two templates", []string{path("plain.txt"), path("page.html")}, "", "invalid usage"},
+		{"template twice", []string{"-t", path("plain.txt"), path("page.html")}, "", "invalid usage"},
+		{"unknown flag", []string{"-x", path("plain.txt")}, "", "invalid usage"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			err := runRender(append([]string{"-o", out}, test.args...))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected no output file, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Fatalf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderErrorPosition(t *testing.T) {
+	dir := writeFiles(t, t.TempDir(), map[string]string{"broken.txt": "line 1\n  {% if %}"})
+	err := runRender([]string{"-o", filepath.Join(dir, "out"), filepath.Join(dir, "broken.txt")})
+	var terr *xt.TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a TemplateError, got %v", err)
+	}
+	if terr.Line != 2 || terr.Snippet() == "" {
+		t.Fatalf("expected an error on line 2 with a snippet, got %+v", terr)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/yzzyx/xt"
+)
+
+// syntaxFlags are the flags configuring the template syntax,
+// shared by the commands parsing templates
+type syntaxFlags struct {
+	delims        string
+	lineStatement string
+	lineComment   string
+	trimBlocks    bool
+	lstripBlocks  bool
+}
+
+// register adds the flags to fs
+func (f *syntaxFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.delims, "delims", "", "space-separated `delimiters`: tag start, tag end, variable start,\n"+
+		"variable end, and optionally comment start and comment end, e.g. '<% %> <%= %>'")
+	fs.StringVar(&f.lineStatement, "line-statement", "", "`prefix` of line statements, e.g. '#'")
+	fs.StringVar(&f.lineComment, "line-comment", "", "`prefix` of line comments, e.g. '##'")
+	fs.BoolVar(&f.trimBlocks, "trim-blocks", false, "remove the first newline after a tag")
+	fs.BoolVar(&f.lstripBlocks, "lstrip-blocks", false, "strip spaces and tabs from the start of a line up to a tag")
+}
+
+// apply configures env with the syntax given by the flags
+func (f *syntaxFlags) apply(env *xt.Environment) error {
+	d := xt.DefaultDelimiters
+	if f.delims != "" {
+		fields := strings.Fields(f.delims)
+		switch len(fields) {
+		case 4:
+			d.CommentStart, d.CommentEnd = "", ""
+		case 6:
+			d.CommentStart, d.CommentEnd = fields[4], fields[5]
+		default:
+			return fmt.Errorf("-delims: expected 4 or 6 delimiters, got %d", len(fields))
+		}
+		d.TagStart, d.TagEnd, d.VarStart, d.VarEnd = fields[0], fields[1], fields[2], fields[3]
+	}
+	d.LineStatement = f.lineStatement
+	d.LineComment = f.lineComment
+	if err := env.SetDelimiters(d); err != nil {
+		return fmt.Errorf("-delims: %s", err)
+	}
+
+	env.SetTrimBlocks(f.trimBlocks)
+	env.SetLstripBlocks(f.lstripBlocks)
+	return nil
+}
@@ -0,0 +1,452 @@
+package xt
+
+import (
+	"strings"
+)
+
+// contextState is the part of a HTML document the parser is in,
+// used to decide how variables are escaped
+type contextState int
+
+const (
+	stateText        contextState = iota // HTML text
+	stateTag                             // inside a tag, e.g. between attributes
+	stateAttrName                        // inside an attribute name
+	stateAfterName                       // after an attribute name, before '='
+	stateBeforeValue                     // after '=', before the attribute value
+	stateAttr                            // inside an attribute value
+	stateComment                         // inside a HTML comment
+	stateRCDATA                          // inside an element containing only text, e.g. <textarea>
+	stateScript                          // inside a <script> element
+	stateStyle                           // inside a <style> element
+)
+
+// attrType is the type of content in an attribute value
+type attrType int
+
+const (
+	attrNormal attrType = iota // plain text
+	attrURL                    // a URL, e.g. href
+	attrJS                     // JavaScript, e.g. onclick
+	attrCSS                    // CSS, e.g. style
+)
+
+// urlPart is the part of a URL the parser is in
+type urlPart int
+
+const (
+	urlStart urlPart = iota // at the start of the URL, where the scheme is
+	urlPath                 // after the start, before any '?' or '#'
+	urlQuery                // in the query or fragment
+)
+
+// jsState is the part of JavaScript or CSS code the parser is in,
+// outside of string literals
+type jsState int
+
+const (
+	jsCode         jsState = iota // code, outside comments and regular expressions
+	jsLineComment                 // inside a '//' comment
+	jsBlockComment                // inside a '/* */' comment
+	jsRegexp                      // inside a regular expression literal
+	jsRegexpClass                 // inside a character class in a regular expression, e.g. '[/]'
+)
+
+// jsRegexpKeywords are the keywords after which a '/' starts a regular
+// expression rather than being a division
+var jsRegexpKeywords = map[string]bool{
+	"break":      true,
+	"case":       true,
+	"continue":   true,
+	"delete":     true,
+	"do":         true,
+	"else":       true,
+	"finally":    true,
+	"in":         true,
+	"instanceof": true,
+	"return":     true,
+	"throw":      true,
+	"try":        true,
+	"typeof":     true,
+	"void":       true,
+}
+
+// urlAttrs are the attributes containing URLs
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"usemap":     true,
+	"xlink:href": true,
+}
+
+// context is the position in a HTML document, as seen by a simplified HTML parser.
+// It is tracked through the text of a template when parsing, so that variables
+// can be escaped differently in e.g. attributes and scripts.
+//
+// The text is scanned in document order, without regard to the tags of the
+// template, so a template where the branches of an if-statement end in
+// different contexts, or a block overridden in another context, may be escaped
+// with the wrong escapers.
+type context struct {
+	state   contextState
+	element string   // name of the current element, e.g. "script"
+	attr    attrType // type of the current attribute
+	delim   byte     // quote around the current attribute value, or 0 if unquoted
+	quote   byte     // quote of the current string literal in JavaScript or CSS, or 0
+	js      jsState  // comment or regular expression in JavaScript or CSS
+	divOp   bool     // a '/' in JavaScript code is a division, not the start of a regular expression
+	url     urlPart  // part of the URL in URL attributes
+}
+
+// escapers returns the names of the escapers used for a variable in the context c
+func (c context) escapers() []string {
+	switch c.state {
+	case stateTag, stateAttrName, stateAfterName:
+		return []string{"html_unquoted"}
+	case stateScript:
+		return []string{c.jsEscaper()}
+	case stateStyle:
+		return []string{"css"}
+	case stateBeforeValue:
+		// the variable starts an unquoted attribute value
+		c.state, c.delim, c.url = stateAttr, 0, urlStart
+		c.quote, c.js = 0, jsCode
+	case stateAttr:
+	default:
+		return []string{"html"}
+	}
+
+	var esc []string
+	switch c.attr {
+	case attrURL:
+		switch c.url {
+		case urlStart:
+			esc = append(esc, "url")
+		case urlPath:
+			esc = append(esc, "url_normalize")
+		default:
+			esc = append(esc, "url_query")
+		}
+	case attrJS:
+		esc = append(esc, c.jsEscaper())
+	case attrCSS:
+		esc = append(esc, "css")
+	}
+	if c.delim == 0 {
+		return append(esc, "html_unquoted")
+	}
+	return append(esc, "html")
+}
+
+// afterVar returns the context after a variable written in the context c.
+// A URL stays at its start until it contains literal text, since a variable
+// may be empty, so that the scheme of a URL split over several variables is
+// checked, e.g. in '<a href="{{ scheme }}{{ rest }}">'.
+// In JavaScript code, a '/' after the variable is a division.
+func (c context) afterVar() context {
+	if c.state == stateBeforeValue {
+		// the variable starts an unquoted attribute value
+		c.state, c.delim, c.url = stateAttr, 0, urlStart
+		c.quote, c.js, c.divOp = 0, jsCode, false
+	}
+	if (c.state == stateScript || c.state == stateAttr && c.attr == attrJS) && c.quote == 0 && c.js == jsCode {
+		c.divOp = true
+	}
+	return c
+}
+
+// jsEscaper returns the escaper used in JavaScript, depending on whether
+// c is inside a string literal, comment or regular expression, or not
+func (c context) jsEscaper() string {
+	if c.quote != 0 || c.js != jsCode {
+		return "js_string"
+	}
+	return "js"
+}
+
+// advance returns the context after the text s
+func (c context) advance(s string) context {
+	for i := 0; i < len(s); {
+		switch c.state {
+		case stateText:
+			j := strings.IndexByte(s[i:], '<')
+			if j < 0 {
+				return c
+			}
+			i += j + 1
+			if strings.HasPrefix(s[i:], "!--") {
+				c.state = stateComment
+				i += 3
+				continue
+			}
+			i = c.startTag(s, i)
+		case stateComment:
+			j := strings.Index(s[i:], "-->")
+			if j < 0 {
+				return c
+			}
+			c.state = stateText
+			i += j + 3
+		case stateRCDATA, stateScript, stateStyle:
+			end := indexEndTag(s[i:], c.element)
+			text := s[i:]
+			if end >= 0 {
+				text = s[i : i+end]
+			}
+			if c.state != stateRCDATA {
+				c.scanCode(text, c.state == stateScript)
+			}
+			if end < 0 {
+				return c
+			}
+			i += end + 2 + len(c.element)
+			c = context{state: stateTag}
+		case stateTag:
+			switch b := s[i]; {
+			case b == '>':
+				c = c.endTag()
+				i++
+			case isHTMLSpace(b) || b == '/':
+				i++
+			default:
+				c.state = stateAttrName
+				c.attr = attrNormal
+				i = c.attrName(s, i)
+			}
+		case stateAttrName:
+			i = c.attrName(s, i)
+		case stateAfterName:
+			switch b := s[i]; {
+			case b == '=':
+				c.state = stateBeforeValue
+				i++
+			case isHTMLSpace(b):
+				i++
+			default:
+				c.state = stateTag
+			}
+		case stateBeforeValue:
+			switch b := s[i]; {
+			case b == '"' || b == '\'':
+				c.state, c.delim = stateAttr, b
+				i++
+			case isHTMLSpace(b):
+				i++
+			case b == '>':
+				c = c.endTag()
+				i++
+			default:
+				c.state, c.delim = stateAttr, 0
+			}
+			c.quote, c.js, c.divOp, c.url = 0, jsCode, false, urlStart
+		case stateAttr:
+			end := len(s)
+			if c.delim != 0 {
+				if j := strings.IndexByte(s[i:], c.delim); j >= 0 {
+					end = i + j
+				}
+			} else if j := strings.IndexFunc(s[i:], func(r rune) bool {
+				return r == '>' || r < 0x80 && isHTMLSpace(byte(r))
+			}); j >= 0 {
+				end = i + j
+			}
+			c.attrValue(s[i:end])
+			if end == len(s) {
+				return c
+			}
+			c.state = stateTag
+			i = end
+			if c.delim != 0 {
+				i++
+			}
+		}
+	}
+	return c
+}
+
+// startTag handles the start of a tag, where s[i-1] is '<'.
+// It returns the position after the tag name.
+func (c *context) startTag(s string, i int) int {
+	j := i
+	if j < len(s) && s[j] == '/' {
+		j++
+	}
+	if j >= len(s) || !isASCIILetter(s[j]) {
+		// not a tag, e.g. '<' in text
+		return i
+	}
+	end := j
+	for end < len(s) && !isHTMLSpace(s[end]) && s[end] != '>' && s[end] != '/' {
+		end++
+	}
+	c.state = stateTag
+	c.element = ""
+	if j == i {
+		c.element = strings.ToLower(s[j:end])
+	}
+	return end
+}
+
+// endTag returns the context after the '>' ending a tag
+func (c context) endTag() context {
+	switch c.element {
+	case "script":
+		return context{state: stateScript, element: c.element}
+	case "style":
+		return context{state: stateStyle, element: c.element}
+	case "textarea", "title":
+		return context{state: stateRCDATA, element: c.element}
+	}
+	return context{state: stateText}
+}
+
+// attrName scans an attribute name starting at s[i], and returns the
+// position after the name. The type of the attribute is set from the name.
+func (c *context) attrName(s string, i int) int {
+	j := i
+	for j < len(s) && !isHTMLSpace(s[j]) && s[j] != '=' && s[j] != '>' && s[j] != '/' {
+		j++
+	}
+	name := strings.ToLower(s[i:j])
+	switch {
+	case strings.HasPrefix(name, "on"):
+		c.attr = attrJS
+	case name == "style":
+		c.attr = attrCSS
+	case urlAttrs[name] || strings.HasSuffix(name, "url") || strings.HasSuffix(name, "uri"):
+		c.attr = attrURL
+	}
+	if j < len(s) {
+		c.state = stateAfterName
+	}
+	return j
+}
+
+// attrValue updates the context with the text s inside an attribute value
+func (c *context) attrValue(s string) {
+	switch c.attr {
+	case attrURL:
+		if c.url == urlStart && s != "" {
+			c.url = urlPath
+		}
+		if strings.ContainsAny(s, "?#") {
+			c.url = urlQuery
+		}
+	case attrJS:
+		c.scanCode(s, true)
+	case attrCSS:
+		c.scanCode(s, false)
+	}
+}
+
+// scanCode updates the context with the JavaScript or CSS code s. String
+// literals and comments are tracked, and in JavaScript also regular expression
+// literals, so that e.g. the quote in '// don't' does not start a string.
+func (c *context) scanCode(s string, js bool) {
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case c.quote != 0:
+			switch b {
+			case '\\':
+				i++
+			case c.quote:
+				c.quote, c.divOp = 0, true
+			}
+		case c.js == jsLineComment:
+			if b == '\n' || b == '\r' {
+				c.js = jsCode
+			}
+		case c.js == jsBlockComment:
+			if b == '*' && i+1 < len(s) && s[i+1] == '/' {
+				c.js = jsCode
+				i++
+			}
+		case c.js == jsRegexp:
+			switch b {
+			case '\\':
+				i++
+			case '[':
+				c.js = jsRegexpClass
+			case '/':
+				c.js, c.divOp = jsCode, true
+			}
+		case c.js == jsRegexpClass:
+			switch b {
+			case '\\':
+				i++
+			case ']':
+				c.js = jsRegexp
+			}
+		case b == '"' || b == '\'' || b == '`':
+			c.quote = b
+		case b == '/' && i+1 < len(s) && s[i+1] == '*':
+			c.js = jsBlockComment
+			i++
+		case !js || isHTMLSpace(b):
+		case b == '/' && i+1 < len(s) && s[i+1] == '/':
+			c.js = jsLineComment
+			i++
+		case b == '/':
+			if !c.divOp {
+				c.js = jsRegexp
+			}
+			c.divOp = false
+		case isJSIdentByte(b):
+			j := i
+			for j < len(s) && isJSIdentByte(s[j]) {
+				j++
+			}
+			c.divOp = !jsRegexpKeywords[s[i:j]]
+			i = j - 1
+		default:
+			// a '/' after e.g. '(' or '=' starts a regular expression,
+			// but not after ')', ']' or the operators '++' and '--'
+			c.divOp = b == ')' || b == ']' || (b == '+' || b == '-') && i > 0 && s[i-1] == b
+		}
+	}
+}
+
+// indexEndTag returns the index of the end tag of element in s, e.g. '</script',
+// or -1 if there is no such tag. The element name is matched case-insensitively.
+func indexEndTag(s, element string) int {
+	for i := 0; ; {
+		j := strings.Index(s[i:], "</")
+		if j < 0 {
+			return -1
+		}
+		i += j
+		end := i + 2 + len(element)
+		if end <= len(s) && strings.EqualFold(s[i+2:end], element) &&
+			(end == len(s) || isHTMLSpace(s[end]) || s[end] == '>' || s[end] == '/') {
+			return i
+		}
+		i += 2
+	}
+}
+
+// isHTMLSpace reports whether b is whitespace in HTML
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// isJSIdentByte reports whether b is part of a JavaScript identifier,
+// keyword or number, for the ASCII characters
+func isJSIdentByte(b byte) bool {
+	return isASCIILetter(b) || '0' <= b && b <= '9' || b == '_' || b == '$'
+}
+
+// isASCIILetter reports whether b is an ASCII letter
+func isASCIILetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
@@ -0,0 +1,109 @@
+package xt
+
+import "testing"
+
+func TestContextEscaping(t *testing.T) {
+	env := NewEnvironment()
+	env.SetAutoescape(AutoescapeExtensions())
+	data := map[string]interface{}{
+		"s":    `a"b'c<d>&`,
+		"sp":   "a b",
+		"n":    1,
+		"list": []interface{}{1, "x"},
+		"js":   "javascript:alert(1)",
+		"url":  "http://example.com/a b?q=1",
+		"path": "a b/c?d",
+		"q":    "a&b=c d",
+		"m":    Markup("<b>"),
+		"v":    "1;alert(1)",
+	}
+	runExecTests(t, env, []execTest{
+		{name: "text.html", tmpl: "<p>{{ s }}</p>", data: data, want: "<p>a&#34;b&#39;c&lt;d&gt;&amp;</p>"},
+		{name: "comment.html", tmpl: "<!-- {{ s }} -->", data: data, want: "<!-- a&#34;b&#39;c&lt;d&gt;&amp; -->"},
+		{name: "textarea.html", tmpl: "<textarea>{{ s }}</textarea>", data: data, want: "<textarea>a&#34;b&#39;c&lt;d&gt;&amp;</textarea>"},
+		{name: "markup.html", tmpl: "<a title='{{ m }}'>{{ m }}</a>", data: data, want: "<a title='<b>'><b></a>"},
+
+		{name: "quoted attribute.html", tmpl: `<a title="{{ s }}">`, data: data, want: `<a title="a&#34;b&#39;c&lt;d&gt;&amp;">`},
+		{name: "single quoted attribute.html", tmpl: `<a title='{{ sp }}'>`, data: data, want: `<a title='a b'>`},
+		{name: "unquoted attribute.html", tmpl: `<a title={{ sp }}>`, data: data, want: `<a title=a&#32;b>`},
+		{name: "unquoted after text.html", tmpl: `<a title=x{{ sp }}>`, data: data, want: `<a title=xa&#32;b>`},
+		{name: "attribute name.html", tmpl: `<a {{ sp }}=1>`, data: data, want: `<a a&#32;b=1>`},
+		{name: "after attribute.html", tmpl: `<a title="x">{{ s }}`, data: data, want: `<a title="x">a&#34;b&#39;c&lt;d&gt;&amp;`},
+
+		{name: "script.html", tmpl: "<script>var x = {{ s }};</script>", data: data, want: `<script>var x = "a\"b'c\u003cd\u003e\u0026";</script>`},
+		{name: "script number.html", tmpl: "<script>var x = {{ n }};</script>", data: data, want: "<script>var x = 1;</script>"},
+		{name: "script list.html", tmpl: "<script>var x = {{ list }};</script>", data: data, want: `<script>var x = [1,"x"];</script>`},
+		{name: "script string.html", tmpl: `<script>var x = "{{ s }}";</script>`, data: data, want: `<script>var x = "a\u0022b\u0027c\u003cd\u003e\u0026";</script>`},
+		{name: "script after string.html", tmpl: `<script>var x = "a\"", y = {{ n }};</script>`, data: data, want: `<script>var x = "a\"", y = 1;</script>`},
+		{name: "script line comment.html", tmpl: "<script>\n// don't\nvar x = {{ v }};</script>", data: data, want: "<script>\n// don't\nvar x = \"1;alert(1)\";</script>"},
+		{name: "script block comment.html", tmpl: "<script>/* don't */ var x = {{ v }};</script>", data: data, want: `<script>/* don't */ var x = "1;alert(1)";</script>`},
+		{name: "script in comment.html", tmpl: "<script>// {{ s }}\n</script>", data: data, want: "<script>// a\\u0022b\\u0027c\\u003cd\\u003e\\u0026\n</script>"},
+		{name: "script regexp.html", tmpl: "<script>var r = /'/; var x = {{ v }};</script>", data: data, want: `<script>var r = /'/; var x = "1;alert(1)";</script>`},
+		{name: "script regexp class.html", tmpl: "<script>var r = /[/']/; var x = {{ v }};</script>", data: data, want: `<script>var r = /[/']/; var x = "1;alert(1)";</script>`},
+		{name: "script regexp after keyword.html", tmpl: "<script>if (a) return /'/; var x = {{ v }};</script>", data: data, want: `<script>if (a) return /'/; var x = "1;alert(1)";</script>`},
+		{name: "script division.html", tmpl: "<script>var x = a / 2, y = (b) / 2; var z = {{ v }};</script>", data: data, want: `<script>var x = a / 2, y = (b) / 2; var z = "1;alert(1)";</script>`},
+		{name: "script division after variable.html", tmpl: "<script>var x = {{ n }} / 2, y = {{ v }};</script>", data: data, want: `<script>var x = 1 / 2, y = "1;alert(1)";</script>`},
+		{name: "script in regexp.html", tmpl: "<script>var r = /{{ sp }}/;</script>", data: data, want: "<script>var r = /a b/;</script>"},
+		{name: "event handler comment.html", tmpl: `<a onclick="/* don't */ f({{ n }})">`, data: data, want: `<a onclick="/* don't */ f(1)">`},
+		{name: "style comment.html", tmpl: "<style>/* don't */ p { color: {{ sp }} }</style>", data: data, want: `<style>/* don't */ p { color: a\20 b }</style>`},
+		{name: "script end tag case.html", tmpl: "<script>x</SCRIPT>{{ s }}", data: data, want: "<script>x</SCRIPT>a&#34;b&#39;c&lt;d&gt;&amp;"},
+		{name: "script unicode.html", tmpl: "<script>Ⱥ</script>{{ s }}", data: data, want: "<script>Ⱥ</script>a&#34;b&#39;c&lt;d&gt;&amp;"},
+		{name: "after script.html", tmpl: "<script></script>{{ m }}{{ s }}", data: data, want: "<script></script><b>a&#34;b&#39;c&lt;d&gt;&amp;"},
+		{name: "event handler.html", tmpl: `<a onclick="f({{ s }})">`, data: data, want: `<a onclick="f(&#34;a\&#34;b&#39;c\u003cd\u003e\u0026&#34;)">`},
+		{name: "event handler string.html", tmpl: `<a onclick="f('{{ sp }}')">`, data: data, want: `<a onclick="f('a b')">`},
+
+		{name: "style.html", tmpl: "<style>p { color: {{ s }} }</style>", data: data, want: `<style>p { color: a\22 b\27 c\3c d\3e \26  }</style>`},
+		{name: "style attribute.html", tmpl: `<p style="color: {{ sp }}">`, data: data, want: `<p style="color: a\20 b">`},
+
+		{name: "url.html", tmpl: `<a href="{{ url }}">`, data: data, want: `<a href="http://example.com/a%20b?q=1">`},
+		{name: "url scheme.html", tmpl: `<a href="{{ js }}">`, data: data, want: `<a href="about:invalid#ZxtZ">`},
+		{name: "url scheme uppercase.html", tmpl: `<a href="{{ 'JavaScript:x' }}">`, want: `<a href="about:invalid#ZxtZ">`},
+		{name: "url mailto.html", tmpl: `<a href="{{ 'mailto:a@b' }}">`, want: `<a href="mailto:a@b">`},
+		{name: "url relative.html", tmpl: `<a href="{{ 'a:b/c' }}">`, want: `<a href="about:invalid#ZxtZ">`},
+		{name: "url relative path.html", tmpl: `<a href="{{ './a:b' }}">`, want: `<a href="./a:b">`},
+		{name: "url unquoted.html", tmpl: `<img src={{ js }}>`, data: data, want: `<img src=about:invalid#ZxtZ>`},
+		{name: "url path.html", tmpl: `<a href="/x/{{ js }}">`, data: data, want: `<a href="/x/javascript:alert(1)">`},
+		{name: "url path normalized.html", tmpl: `<a href="/{{ path }}">`, data: data, want: `<a href="/a%20b/c?d">`},
+		{name: "url query.html", tmpl: `<a href="/x?q={{ q }}">`, data: data, want: `<a href="/x?q=a%26b%3Dc%20d">`},
+		{name: "url fragment.html", tmpl: `<a href="/x#{{ q }}">`, data: data, want: `<a href="/x#a%26b%3Dc%20d">`},
+		{name: "url split.html", tmpl: `<a href="{{ u }}{{ js }}">`, data: map[string]string{"u": "", "js": "javascript:alert(1)"}, want: `<a href="about:invalid#ZxtZ">`},
+		{name: "url split scheme.html", tmpl: `<a href="{{ u }}{{ v }}">`, data: map[string]string{"u": "java", "v": "script:alert(1)"}, want: `<a href="javaabout:invalid#ZxtZ">`},
+		{name: "url split colon.html", tmpl: `<a href="{{ u }}{{ v }}">`, data: map[string]string{"u": "javascript", "v": ":alert(1)"}, want: `<a href="javascriptabout:invalid#ZxtZ">`},
+		{name: "url split unquoted.html", tmpl: `<a href={{ u }}{{ js }}>`, data: map[string]string{"u": "", "js": "javascript:alert(1)"}, want: `<a href=about:invalid#ZxtZ>`},
+		{name: "url split allowed.html", tmpl: `<a href="{{ u }}{{ v }}">`, data: map[string]string{"u": "https://a", "v": "/b c"}, want: `<a href="https://a/b%20c">`},
+		{name: "url split after text.html", tmpl: `<a href="/{{ u }}{{ js }}">`, data: map[string]string{"u": "", "js": "javascript:alert(1)"}, want: `<a href="/javascript:alert(1)">`},
+		{name: "url attribute suffix.html", tmpl: `<form data-url="{{ js }}">`, data: data, want: `<form data-url="about:invalid#ZxtZ">`},
+		{name: "url next attribute.html", tmpl: `<a href="/" title="{{ js }}">`, data: data, want: `<a href="/" title="javascript:alert(1)">`},
+
+		{name: "disabled.html", tmpl: `{% autoescape false %}<a href="{{ js }}">{% endautoescape %}`, data: data, want: `<a href="javascript:alert(1)">`},
+		{name: "safe url.html", tmpl: `<a href="{{ js | safe }}">`, data: data, want: `<a href="javascript:alert(1)">`},
+	})
+}
+
+func TestIndexEndTag(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want int
+	}{
+		{"x</script>", 1},
+		{"x</SCRIPT>", 1},
+		{"x</script", 1},
+		{"x</script x", 1},
+		{"x</scripts></script>", 11},
+		{"x</scr", -1},
+		{"Ⱥ</script", 2},
+		{"ȺȺȺ</scrip", -1},
+		{"", -1},
+	} {
+		if got := indexEndTag(test.s, "script"); got != test.want {
+			t.Errorf("indexEndTag(%q): expected %d, got %d", test.s, test.want, got)
+		}
+	}
+
+	// lowercasing 'Ⱥ' makes it longer, which must not move the end tag
+	env := NewEnvironment()
+	env.SetAutoescape(AutoescapeExtensions())
+	if _, err := render(env, "unicode.html", "<script>Ⱥ</script", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
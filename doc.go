@@ -0,0 +1,89 @@
+// Package xt implements a template language in the style of Jinja2 and Django.
+//
+// A template is text containing variables, which are replaced with values
+// when the template is executed, and tags, which control the logic of the template:
+//
+//  <ul>
+//  {% for user in users %}
+//    <li>{{ user.Name | title }}</li>
+//  {% endfor %}
+//  </ul>
+//
+// Templates are parsed into a Tree, which can then be executed any number of times
+// with different data:
+//
+//  t, err := xt.Parse("users", src)
+//  if err != nil {
+//  	return err
+//  }
+//  err = t.Execute(os.Stdout, map[string]interface{}{"users": users})
+//
+// Templates that include or extend other templates are loaded through an
+// Environment, which also holds the filters, tests, functions and global
+// variables available to the templates. Functions are called with positional
+// and keyword arguments, e.g. '{{ url_for("user", id=u.ID) }}', and methods of
+// Go values are called in the same way, e.g. '{{ user.FullName() }}'. A function
+// or method returning a non-nil error stops the execution of the template with
+// an error at the position of the call.
+//
+// Variables are assigned with set, either from an expression, by unpacking
+// a sequence, or by capturing the output of a block:
+//
+//  {% set title = page.Title | title %}
+//  {% set width, height = size %}
+//  {% set nav %}<a href="/">Home</a>{% endset %}
+//
+// The scope of an assigned variable depends on where it is assigned:
+//
+//  - at the top level of a template, including inside if-statements, the
+//    variable is visible in the rest of the template, in the blocks and macros
+//    of the template, and in included templates. Top level variables and macros
+//    are also the ones imported from the template by import statements.
+//  - inside a for-loop, the variable is visible until the end of the current
+//    iteration, so a variable assigned in the loop body cannot change the value
+//    of a variable outside the loop.
+//  - inside a block, a macro, a call block or the body of a block set, the
+//    variable is visible until the end of the block.
+//  - '{% with a = 1, b = 2 %}...{% endwith %}' creates a new scope, where a and b
+//    are assigned. The values are evaluated before any variable is assigned.
+//
+// An included template sees the variables visible where it is included, but
+// variables assigned in the included template are not visible to the includer.
+//
+// Parts of templates that are repeated can be defined as macros, which are
+// called like functions and return their rendered body:
+//
+//  {% macro field(name, label, type="text") %}
+//    <label>{{ label }} <input type="{{ type }}" name="{{ name }}"></label>
+//  {% endmacro %}
+//  {{ field("email", "E-mail", type="email") }}
+//
+// A macro called from a call block, '{% call field(...) %}...{% endcall %}',
+// renders the body of the block with 'caller()'. Macros are shared between
+// templates by importing them, either as a map or by name:
+//
+//  {% import "forms.html" as forms %}{{ forms.field("email", "E-mail") }}
+//  {% from "forms.html" import field, textarea as ta %}
+//
+// Only the macros and variables defined at the top level of the imported
+// template are imported, and names starting with '_' are private. The imported
+// template does not see the variables of the importing template, unless the
+// import ends with 'with context'.
+//
+// Autoescaping of variables is enabled per environment with SetAutoescape,
+// e.g. for all templates ending with .html. Values of the type Markup, or
+// values passed through the 'safe' filter, are written without escaping,
+// and '{% autoescape false %}' disables escaping in a part of a template.
+//
+// Escaping depends on where in the HTML document a variable is written.
+// Variables in text and attributes are HTML-escaped, variables in scripts
+// and event handler attributes are written as JavaScript literals, variables
+// in style elements and attributes are CSS-escaped, and variables in URL
+// attributes such as href are percent-encoded. URLs with other schemes than
+// http, https and mailto, e.g. 'javascript:', are replaced with "about:invalid#ZxtZ".
+//
+// Errors found when parsing or executing a template are of the type
+// *TemplateError, which holds the name of the template, the line and column
+// of the error, and the offending line of the template. ParseAll continues
+// parsing after syntax errors, and returns all errors found as an ErrorList.
+package xt
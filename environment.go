@@ -0,0 +1,280 @@
+package xt
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Environment holds the configuration shared by a set of templates,
+// such as the available filters, tests, functions and global variables,
+// and the loader used to find templates by name.
+// Parsed templates are kept in a cache, so that they are only parsed once.
+// An environment is safe for concurrent use by multiple goroutines.
+type Environment struct {
+	mu         sync.RWMutex
+	loader     Loader
+	globals    map[string]interface{}
+	filters    map[string]FilterFunc
+	tests      map[string]TestFunc
+	functions  map[string]interface{}
+	delims     Delimiters
+	autoescape func(name string) bool
+
+	trimBlocks   bool
+	lstripBlocks bool
+
+	cache *templateCache
+}
+
+// Delimiters are the markers identifying tags, variables and comments in a template.
+// Comments are disabled if CommentStart and CommentEnd are empty.
+//
+// If LineStatement is set, a line starting with the prefix is handled as a tag,
+// e.g. '# for x in y' is the same as '{% for x in y %}'. The statement ends at the
+// end of the line, and may end with a ':'. If LineComment is set, everything
+// from the prefix to the end of the line is ignored, e.g. '## comment'.
+type Delimiters struct {
+	TagStart      string // start of a tag, e.g. '{%'
+	TagEnd        string // end of a tag, e.g. '%}'
+	VarStart      string // start of a variable, e.g. '{{'
+	VarEnd        string // end of a variable, e.g. '}}'
+	CommentStart  string // start of a comment, e.g. '{#'
+	CommentEnd    string // end of a comment, e.g. '#}'
+	LineStatement string // prefix of line statements, e.g. '#', or "" to disable line statements
+	LineComment   string // prefix of line comments, e.g. '##', or "" to disable line comments
+}
+
+// DefaultDelimiters are the delimiters used unless configured otherwise
+var DefaultDelimiters = Delimiters{
+	TagStart:     "{%",
+	TagEnd:       "%}",
+	VarStart:     "{{",
+	VarEnd:       "}}",
+	CommentStart: "{#",
+	CommentEnd:   "#}",
+}
+
+// DefaultCacheSize is the number of parsed templates kept by an environment
+const DefaultCacheSize = 400
+
+// defaultEnvironment is used by templates created with NewTree
+var defaultEnvironment = NewEnvironment()
+
+// NewEnvironment creates a new environment, with the builtin filters and tests registered
+func NewEnvironment() *Environment {
+	e := &Environment{
+		globals:   make(map[string]interface{}),
+		filters:   make(map[string]FilterFunc),
+		tests:     make(map[string]TestFunc),
+		functions: make(map[string]interface{}),
+		delims:    DefaultDelimiters,
+		cache:     newTemplateCache(DefaultCacheSize),
+	}
+	for name, fn := range builtinFilters {
+		e.filters[name] = fn
+	}
+	for name, fn := range builtinTests {
+		e.tests[name] = fn
+	}
+	return e
+}
+
+// NewTree creates a new parser tree using this environment
+func (e *Environment) NewTree(name string) *Tree {
+	return &Tree{name: name, env: e}
+}
+
+// AddFilter registers fn as the filter name, replacing any existing
+// filter with the same name. Filters must be registered before parsing
+// any templates using them.
+func (e *Environment) AddFilter(name string, fn FilterFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filters[name] = fn
+}
+
+// AddTest registers fn as the test name, replacing any existing
+// test with the same name. Tests must be registered before parsing
+// any templates using them.
+func (e *Environment) AddTest(name string, fn TestFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tests[name] = fn
+}
+
+// AddFunction registers fn as a function callable from templates, e.g.
+// '{{ name(arg1, arg2) }}'. fn must be a function returning either a
+// single value, or a value and an error. If the error is not nil, execution
+// stops with an error at the position of the call. If the last parameter of
+// fn has the type Kwargs, fn accepts keyword arguments, e.g.
+// '{{ name(arg1, key=value) }}'. It panics if fn is not a valid function.
+func (e *Environment) AddFunction(name string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		panic(fmt.Sprintf("function %s: value of type %T is not a function", name, fn))
+	}
+	if err := checkFuncType(v.Type()); err != nil {
+		panic(fmt.Sprintf("function %s: %s", name, err))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.functions[name] = fn
+}
+
+// AddGlobal sets a global variable, which is available in all templates
+// unless shadowed by a variable with the same name in the data given to Execute.
+func (e *Environment) AddGlobal(name string, value interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.globals[name] = value
+}
+
+// SetDelimiters changes the delimiters used in templates parsed after the call.
+// Any cached templates are removed.
+func (e *Environment) SetDelimiters(d Delimiters) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.delims = d
+	e.mu.Unlock()
+	e.cache.clear()
+	return nil
+}
+
+// validate checks that the delimiters can be used to lex a template
+func (d Delimiters) validate() error {
+	if d.TagStart == "" || d.TagEnd == "" || d.VarStart == "" || d.VarEnd == "" {
+		return fmt.Errorf("delimiters cannot be empty")
+	}
+	if (d.CommentStart == "") != (d.CommentEnd == "") {
+		return fmt.Errorf("comment delimiters must both be set, or both be empty")
+	}
+	if d.TagStart == d.VarStart || d.TagStart == d.CommentStart || d.VarStart == d.CommentStart {
+		return fmt.Errorf("tag, variable and comment start delimiters must differ")
+	}
+	if d.LineStatement != "" && d.LineStatement == d.LineComment {
+		return fmt.Errorf("line statement and line comment prefixes must differ")
+	}
+	return nil
+}
+
+// SetAutoescape sets the function deciding if the output of variables in a
+// template should be HTML-escaped, based on the name of the template, e.g.
+// AutoescapeExtensions(".html", ".xml"). A nil function disables autoescaping.
+// The setting can be overridden in a template with '{% autoescape false %}'.
+// Any cached templates are removed.
+func (e *Environment) SetAutoescape(fn func(name string) bool) {
+	e.mu.Lock()
+	e.autoescape = fn
+	e.mu.Unlock()
+	e.cache.clear()
+}
+
+// SetTrimBlocks sets whether the first newline after a tag is removed.
+// It can be disabled for a single tag with a '+' before the end delimiter,
+// e.g. '{% if x +%}'. Any cached templates are removed.
+func (e *Environment) SetTrimBlocks(enabled bool) {
+	e.mu.Lock()
+	e.trimBlocks = enabled
+	e.mu.Unlock()
+	e.cache.clear()
+}
+
+// SetLstripBlocks sets whether spaces and tabs are stripped from the start of
+// a line up to a tag. It can be disabled for a single tag with a '+' after the
+// start delimiter, e.g. '{%+ if x %}'. Any cached templates are removed.
+func (e *Environment) SetLstripBlocks(enabled bool) {
+	e.mu.Lock()
+	e.lstripBlocks = enabled
+	e.mu.Unlock()
+	e.cache.clear()
+}
+
+// SetCacheSize sets the maximum number of parsed templates kept by the
+// environment. A size of 0 disables caching, and a negative size removes the limit.
+func (e *Environment) SetCacheSize(size int) {
+	e.cache.resize(size)
+}
+
+// SetLoader sets the loader used to find templates by name,
+// and removes any cached templates
+func (e *Environment) SetLoader(l Loader) {
+	e.mu.Lock()
+	e.loader = l
+	e.mu.Unlock()
+	e.cache.clear()
+}
+
+// GetTemplate returns the parsed template called name, loading it with the
+// loader of the environment. Parsed templates are cached, so that subsequent
+// calls return the same tree without parsing the template again.
+func (e *Environment) GetTemplate(name string) (*Tree, error) {
+	if t, ok := e.cache.get(name); ok {
+		return t, nil
+	}
+
+	e.mu.RLock()
+	loader := e.loader
+	e.mu.RUnlock()
+	if loader == nil {
+		return nil, fmt.Errorf("%s: no loader configured", name)
+	}
+
+	src, err := loader.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	t := e.NewTree(name)
+	if err = t.Parse(src); err != nil {
+		return nil, err
+	}
+	e.cache.add(name, t)
+	return t, nil
+}
+
+// filter returns the filter called name, or nil if there is no such filter
+func (e *Environment) filter(name string) FilterFunc {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.filters[name]
+}
+
+// test returns the test called name, or nil if there is no such test
+func (e *Environment) test(name string) TestFunc {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.tests[name]
+}
+
+// global returns the global variable or function called name
+func (e *Environment) global(name string) (interface{}, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if val, ok := e.globals[name]; ok {
+		return val, true
+	}
+	fn, ok := e.functions[name]
+	return fn, ok
+}
+
+// lexOptions returns the options used when lexing templates
+func (e *Environment) lexOptions() lexOptions {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return lexOptions{
+		delims:       e.delims,
+		trimBlocks:   e.trimBlocks,
+		lstripBlocks: e.lstripBlocks,
+	}
+}
+
+// autoescapeFor reports whether output should be escaped in the template name
+func (e *Environment) autoescapeFor(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.autoescape != nil && e.autoescape(name)
+}
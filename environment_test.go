@@ -0,0 +1,161 @@
+package xt
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvironment(t *testing.T) {
+	env := NewEnvironment()
+	env.AddGlobal("site", "example.com")
+	env.AddGlobal("n", 1)
+	env.AddFunction("double", func(x int) int { return 2 * x })
+	env.AddTest("short", func(value interface{}, args ...interface{}) (bool, error) {
+		s, _ := value.(string)
+		return len(s) < 3, nil
+	})
+	env.AddTest("fail", func(value interface{}, args ...interface{}) (bool, error) {
+		return false, errors.New("failed")
+	})
+	env.AddTest("panic", func(value interface{}, args ...interface{}) (bool, error) {
+		return value.(string) == "", nil
+	})
+	env.AddFilter("upper", func(value interface{}, args ...interface{}) (interface{}, error) {
+		return "replaced", nil
+	})
+	runExecTests(t, env, []execTest{
+		{name: "global", tmpl: "{{ site }}", want: "example.com"},
+		{name: "global shadowed by data", tmpl: "{{ n }}", data: map[string]int{"n": 2}, want: "2"},
+		{name: "global shadowed by variable", tmpl: "{% set n = 3 %}{{ n }}", want: "3"},
+		{name: "function", tmpl: "{{ double(n) }}", want: "2"},
+		{name: "test", tmpl: "{{ 'ab' is short }}{{ 'abc' is not short }}", want: "truetrue"},
+		{name: "replaced filter", tmpl: "{{ 'a' | upper }}", want: "replaced"},
+		{name: "test error", tmpl: "{{ 1 is fail }}", err: ":1:4: test 'fail': failed"},
+		{name: "test panic", tmpl: "{{ 1 is panic }}", err: ":1:4: test 'panic': panic: interface conversion"},
+		{name: "unknown test", tmpl: "{{ 1 is missing }}", err: "unknown test 'missing'"},
+	})
+}
+
+func TestAddFunctionInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   interface{}
+		err  string
+	}{
+		{"not a function", 1, "function f: value of type int is not a function"},
+		{"no result", func() {}, "function f: function must return a value, or a value and an error, not 0 values"},
+		{"no error", func() (int, int) { return 0, 0 }, "not 2 values"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if s, _ := r.(string); !strings.Contains(s, test.err) {
+					t.Fatalf("expected panic containing %q, got %v", test.err, r)
+				}
+			}()
+			NewEnvironment().AddFunction("f", test.fn)
+		})
+	}
+}
+
+// countingLoader is a MapLoader counting the number of times each template is loaded
+type countingLoader struct {
+	templates MapLoader
+	loads     map[string]int
+}
+
+func (l *countingLoader) Load(name string) (string, error) {
+	l.loads[name]++
+	return l.templates.Load(name)
+}
+
+func TestGetTemplate(t *testing.T) {
+	l := &countingLoader{
+		templates: MapLoader{"a": "a", "b": "b", "c": "c", "broken": "{% if %}"},
+		loads:     make(map[string]int),
+	}
+	env := NewEnvironment()
+	env.SetLoader(l)
+
+	get := func(name string) *Tree {
+		t.Helper()
+		tree, err := env.GetTemplate(name)
+		if err != nil {
+			t.Fatalf("GetTemplate(%q): %s", name, err)
+		}
+		return tree
+	}
+
+	// parsed templates are cached
+	if get("a") != get("a") || l.loads["a"] != 1 {
+		t.Fatalf("expected a cached template, loaded %d times", l.loads["a"])
+	}
+
+	// the least recently used template is evicted
+	env.SetCacheSize(2)
+	get("b")
+	get("a")
+	get("c")
+	get("a")
+	get("b")
+	if l.loads["a"] != 1 || l.loads["b"] != 2 || l.loads["c"] != 1 {
+		t.Fatalf("unexpected number of loads: %v", l.loads)
+	}
+
+	// setting the loader clears the cache
+	env.SetLoader(l)
+	get("a")
+	if l.loads["a"] != 2 {
+		t.Fatalf("expected the cache to be cleared, loaded %d times", l.loads["a"])
+	}
+
+	// a size of 0 disables caching
+	env.SetCacheSize(0)
+	get("c")
+	get("c")
+	if l.loads["c"] != 3 {
+		t.Fatalf("expected no caching, loaded %d times", l.loads["c"])
+	}
+
+	// templates with syntax errors are not cached
+	env.SetCacheSize(-1)
+	for i := 0; i < 2; i++ {
+		var terr *TemplateError
+		if _, err := env.GetTemplate("broken"); !errors.As(err, &terr) || terr.Kind != SyntaxError {
+			t.Fatalf("expected a syntax error, got %v", err)
+		}
+	}
+	if l.loads["broken"] != 2 {
+		t.Fatalf("expected broken template to be loaded twice, loaded %d times", l.loads["broken"])
+	}
+
+	if _, err := env.GetTemplate("missing"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+	if _, err := NewEnvironment().GetTemplate("a"); err == nil || err.Error() != "a: no loader configured" {
+		t.Fatalf("expected no loader error, got %v", err)
+	}
+}
+
+func TestGetTemplateSyntaxError(t *testing.T) {
+	env := newTestEnv(map[string]string{"broken": "{% if %}" + strings.Repeat("{{ x }}", 10)})
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := env.GetTemplate("broken"); err == nil {
+			t.Fatal("expected a syntax error")
+		}
+	}
+
+	// the lexer goroutines exit shortly after the parser stops
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked %d goroutines", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,141 @@
+package xt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind is the kind of a TemplateError
+type ErrorKind int
+
+const (
+	SyntaxError  ErrorKind = iota + 1 // the template could not be parsed
+	RuntimeError                      // the template could not be executed
+)
+
+// String returns a description of the kind of error
+func (k ErrorKind) String() string {
+	switch k {
+	case SyntaxError:
+		return "syntax error"
+	case RuntimeError:
+		return "runtime error"
+	}
+	return "unknown error"
+}
+
+// TemplateError is an error found when parsing or executing a template.
+// The errors returned by Parse and Execute can be inspected with errors.As:
+//
+//  var terr *xt.TemplateError
+//  if errors.As(err, &terr) {
+//  	fmt.Printf("%s\n%s\n", terr, terr.Snippet())
+//  }
+type TemplateError struct {
+	Kind    ErrorKind
+	Name    string // name of the template
+	Line    int    // line of the error, starting at 1, or 0 if unknown
+	Col     int    // column of the error in runes, starting at 1, or 0 if unknown
+	Source  string // the line of the template containing the error
+	Message string // description of the error
+	Err     error  // underlying error, if any
+}
+
+// Error returns the error formatted as 'name:line:col: message'
+func (e *TemplateError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Name, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Name, e.Line, e.Col, e.Message)
+}
+
+// Unwrap returns the underlying error
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet returns the line of the template containing the error, followed
+// by a line with a caret pointing at the column of the error, e.g.
+//
+//  <p>{{ user.name | nosuchfilter }}</p>
+//                    ^
+//
+// It returns an empty string if the position of the error is unknown.
+func (e *TemplateError) Snippet() string {
+	if e.Line == 0 {
+		return ""
+	}
+	var caret strings.Builder
+	for k, r := range []rune(e.Source) {
+		if k >= e.Col-1 {
+			break
+		}
+		// keep tabs, so that the caret is aligned with the source line
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return e.Source + "\n" + caret.String()
+}
+
+// ErrorList is a list of errors, returned by ParseAll when
+// one or more errors are found in a template
+type ErrorList []*TemplateError
+
+// Error returns the first error, followed by the number of other errors
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Unwrap returns the errors in the list, so that they can be
+// inspected with errors.Is and errors.As
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for k, e := range l {
+		errs[k] = e
+	}
+	return errs
+}
+
+// newError creates a TemplateError at the byte position pos in the template.
+// If pos is negative, the position is unknown. The first of args that is an
+// error is used as the underlying error.
+func (t *Tree) newError(kind ErrorKind, pos Pos, format string, args ...interface{}) *TemplateError {
+	e := &TemplateError{
+		Kind:    kind,
+		Name:    t.name,
+		Message: fmt.Sprintf(format, args...),
+	}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			e.Err = err
+			break
+		}
+	}
+	if pos < 0 {
+		return e
+	}
+
+	e.Line, e.Col = t.Location(pos)
+	if int(pos) > len(t.input) {
+		pos = Pos(len(t.input))
+	}
+	start := strings.LastIndexByte(t.input[:pos], '\n') + 1
+	end := strings.IndexByte(t.input[pos:], '\n')
+	if end < 0 {
+		end = len(t.input)
+	} else {
+		end += int(pos)
+	}
+	e.Source = strings.TrimSuffix(t.input[start:end], "\r")
+	return e
+}
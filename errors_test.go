@@ -0,0 +1,116 @@
+package xt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// templateError parses and executes src, and returns the resulting TemplateError
+func templateError(t *testing.T, env *Environment, name, src string, data interface{}) *TemplateError {
+	t.Helper()
+	_, err := render(env, name, src, data)
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a TemplateError, got %v", err)
+	}
+	return terr
+}
+
+func TestTemplateError(t *testing.T) {
+	errFail := errors.New("failed")
+	env := newTestEnv(map[string]string{"part": "a\n  {{ 1 / 0 }}"})
+	env.AddFunction("fail", func() (int, error) { return 0, errFail })
+
+	tests := []struct {
+		name    string
+		src     string
+		kind    ErrorKind
+		line    int
+		col     int
+		message string
+		snippet string
+	}{
+		{"unknown tag", "a\n{% nosuchtag %}", SyntaxError, 2, 4, "unknown tag nosuchtag", "{% nosuchtag %}\n   ^"},
+		{"unclosed variable", "{{ x", SyntaxError, 1, 5, "unclosed action", "{{ x\n    ^"},
+		{"unclosed tag", "abc {% if", SyntaxError, 1, 10, "unclosed action", "abc {% if\n         ^"},
+		{"unexpected end", "{% if x %}", SyntaxError, 1, 11, "expected 'endif'-tag, got end-of-file", "{% if x %}\n          ^"},
+		{"tabs", "\t\t{{ x y }}", SyntaxError, 1, 8, "", "\t\t{{ x y }}\n\t\t     ^"},
+		{"unicode", "åäö {{ ) }}", SyntaxError, 1, 8, "", "åäö {{ ) }}\n       ^"},
+		{"crlf", "a\r\n{{ ) }}\r\nb", SyntaxError, 2, 4, "", "{{ ) }}\n   ^"},
+		{"unknown filter", "<p>{{ x | nosuchfilter }}</p>", SyntaxError, 1, 11, "unknown filter 'nosuchfilter'", "<p>{{ x | nosuchfilter }}</p>\n          ^"},
+		{"division by zero", "\n\n  {{ 1 / 0 }}", RuntimeError, 3, 6, "division by zero", "  {{ 1 / 0 }}\n     ^"},
+		{"function error", "{{ fail() }}", RuntimeError, 1, 4, "fail: failed", "{{ fail() }}\n   ^"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terr := templateError(t, env, test.name, test.src, nil)
+			if terr.Kind != test.kind || terr.Name != test.name || terr.Line != test.line || terr.Col != test.col {
+				t.Fatalf("expected %s at %s:%d:%d, got %s at %s:%d:%d", test.kind, test.name, test.line, test.col,
+					terr.Kind, terr.Name, terr.Line, terr.Col)
+			}
+			if test.message != "" && terr.Message != test.message {
+				t.Errorf("expected message %q, got %q", test.message, terr.Message)
+			}
+			if want := fmt.Sprintf("%s:%d:%d: %s", test.name, test.line, test.col, terr.Message); terr.Error() != want {
+				t.Errorf("expected %q, got %q", want, terr.Error())
+			}
+			if terr.Snippet() != test.snippet {
+				t.Errorf("expected snippet:\n%s\ngot:\n%s", test.snippet, terr.Snippet())
+			}
+		})
+	}
+
+	// errors in included templates are reported at the included template
+	terr := templateError(t, env, "main", "{% include 'part' %}", nil)
+	if terr.Name != "part" || terr.Line != 2 || terr.Col != 6 {
+		t.Errorf("expected error at part:2:6, got %s", terr)
+	}
+
+	// the underlying error of a function is kept
+	terr = templateError(t, env, "wrapped", "{{ fail() }}", nil)
+	if !errors.Is(terr, errFail) {
+		t.Errorf("expected the error to wrap %v, got %v", errFail, terr.Err)
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	// the lexer stops at the unclosed end tag, which must not stop the parser
+	for _, src := range []string{
+		"{% if x %}a{% endif %",
+		"{% for x in y %}{% endfor",
+		"{% block b %}{% endblock %",
+		"{% raw %}{% endraw",
+		"{% autoescape true %}{% endautoescape %",
+		"{% macro m() %}{% endmacro",
+		"{% if x %}{% else %",
+	} {
+		t.Run(src, func(t *testing.T) {
+			var err error
+			timeout(t, func() { _, err = Parse("incomplete", src) })
+			var terr *TemplateError
+			if !errors.As(err, &terr) || terr.Kind != SyntaxError || terr.Line != 1 || terr.Col == 0 {
+				t.Fatalf("expected a positioned syntax error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for kind, want := range map[ErrorKind]string{
+		SyntaxError:  "syntax error",
+		RuntimeError: "runtime error",
+		0:            "unknown error",
+	} {
+		if kind.String() != want {
+			t.Errorf("expected %q, got %q", want, kind)
+		}
+	}
+}
+
+func TestErrorWithoutPosition(t *testing.T) {
+	terr := &TemplateError{Kind: RuntimeError, Name: "t", Message: "failed"}
+	if terr.Error() != "t: failed" || terr.Snippet() != "" {
+		t.Fatalf("unexpected error %q with snippet %q", terr.Error(), terr.Snippet())
+	}
+}
@@ -0,0 +1,186 @@
+package xt
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Markup is a string that is safe to include in the output without escaping,
+// e.g. a HTML fragment from a trusted source. Values can also be marked as
+// safe in a template with the 'safe' filter. Markup is never escaped, in any
+// context, so it must not contain untrusted data.
+type Markup string
+
+// DefaultAutoescapeExtensions are the extensions of the templates escaped by
+// the policy returned by AutoescapeExtensions, unless other extensions are given
+var DefaultAutoescapeExtensions = []string{".html", ".htm", ".xml"}
+
+// AutoescapeExtensions returns an autoescape policy for Environment.SetAutoescape,
+// which enables autoescaping for templates with one of the given extensions,
+// e.g. ".html". The comparison is case-insensitive.
+// If no extensions are given, DefaultAutoescapeExtensions is used.
+func AutoescapeExtensions(extensions ...string) func(name string) bool {
+	if len(extensions) == 0 {
+		extensions = DefaultAutoescapeExtensions
+	}
+	exts := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		exts[strings.ToLower(ext)] = true
+	}
+	return func(name string) bool {
+		return exts[strings.ToLower(path.Ext(name))]
+	}
+}
+
+// unsafeURL replaces URLs with schemes that are not allowed in URL attributes,
+// such as 'javascript:'
+const unsafeURL = "about:invalid#ZxtZ"
+
+// escapers are the functions used to escape variables, by the names
+// used in VarStmt.Escapers
+var escapers = map[string]func(string) string{
+	"html":          html.EscapeString,
+	"html_unquoted": escapeUnquotedAttr,
+	"js":            escapeJSValue,
+	"js_string":     escapeJSString,
+	"css":           escapeCSS,
+	"url":           filterURL,
+	"url_normalize": normalizeURL,
+	"url_query":     escapeURLQuery,
+}
+
+// escapeValue returns the string representation of val, escaped by each of the
+// escapers in turn. Values of the type Markup are returned unchanged.
+func escapeValue(val interface{}, names []string) string {
+	if m, ok := val.(Markup); ok {
+		return string(m)
+	}
+
+	var s string
+	if len(names) > 0 && names[0] == "js" {
+		// JavaScript values are written as literals, so that e.g.
+		// strings are quoted and lists become arrays
+		s = jsValue(val)
+		names = names[1:]
+	} else {
+		s = toText(val)
+	}
+	for _, name := range names {
+		s = escapers[name](s)
+	}
+	return s
+}
+
+// escapeHTML escapes the string representation of val for use in HTML.
+// Values of the type Markup are returned unchanged.
+func escapeHTML(val interface{}) Markup {
+	if m, ok := val.(Markup); ok {
+		return m
+	}
+	return Markup(html.EscapeString(toText(val)))
+}
+
+// escapeUnquotedAttr escapes s for use in an unquoted attribute value,
+// where whitespace would end the value
+func escapeUnquotedAttr(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case ' ', '\t', '\n', '\r', '\f', '\'', '"', '`', '=', '<', '>', '&', 0:
+			fmt.Fprintf(&sb, "&#%d;", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// jsValue returns val as a JavaScript literal
+func jsValue(val interface{}) string {
+	// json.Marshal escapes '<', '>' and '&', so the result cannot end the script element
+	b, err := json.Marshal(val)
+	if err != nil {
+		b, _ = json.Marshal(toText(val))
+	}
+	return string(b)
+}
+
+// escapeJSValue escapes s for use as a value in JavaScript, by writing it as a string literal
+func escapeJSValue(s string) string {
+	return jsValue(s)
+}
+
+// escapeJSString escapes s for use inside a JavaScript string literal
+func escapeJSString(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '\'' || r == '"' || r == '`' || r == '<' || r == '>' ||
+			r == '&' || r == '=' || r == '/' || r < ' ' || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&sb, `\u%04x`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// escapeCSS escapes s for use in CSS, so that it cannot end a string,
+// a declaration or the style element
+func escapeCSS(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf && !isAlphaNumeric(r) && r != '-' && r != '.' && r != '#' && r != '%' {
+			fmt.Fprintf(&sb, `\%x `, r)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// filterURL checks that the scheme of the URL s is allowed, and normalizes it.
+// URLs with other schemes than http, https and mailto are replaced, to prevent
+// e.g. 'javascript:' URLs from untrusted values.
+func filterURL(s string) string {
+	if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+		switch strings.ToLower(s[:i]) {
+		case "http", "https", "mailto":
+		default:
+			return unsafeURL
+		}
+	}
+	return normalizeURL(s)
+}
+
+// normalizeURL percent-encodes the characters in s that are not allowed in URLs
+func normalizeURL(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if isAlphaNumeric(rune(b)) && b < utf8.RuneSelf || strings.IndexByte("-_.~!*'();:@&=+$,/?#[]%", b) >= 0 {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", b)
+	}
+	return sb.String()
+}
+
+// escapeURLQuery percent-encodes s for use in the query or fragment of a URL
+func escapeURLQuery(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if isAlphaNumeric(rune(b)) && b < utf8.RuneSelf || strings.IndexByte("-_.~", b) >= 0 {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", b)
+	}
+	return sb.String()
+}
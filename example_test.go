@@ -0,0 +1,41 @@
+package xt_test
+
+import (
+	"os"
+
+	"github.com/yzzyx/xt"
+)
+
+func ExampleParse() {
+	t, err := xt.Parse("users", "{% for user in users %}{{ user | title }}\n{% endfor %}")
+	if err != nil {
+		panic(err)
+	}
+	err = t.Execute(os.Stdout, map[string]interface{}{"users": []string{"alice", "bob"}})
+	if err != nil {
+		panic(err)
+	}
+	// Output:
+	// Alice
+	// Bob
+}
+
+func ExampleEnvironment() {
+	env := xt.NewEnvironment()
+	env.SetLoader(xt.MapLoader{
+		"base.html":  "<title>{% block title %}{% endblock %}</title>",
+		"index.html": "{% extends 'base.html' %}{% block title %}{{ site }}{% endblock %}",
+	})
+	env.SetAutoescape(xt.AutoescapeExtensions(".html"))
+	env.AddGlobal("site", "Tom & Jerry")
+
+	t, err := env.GetTemplate("index.html")
+	if err != nil {
+		panic(err)
+	}
+	if err = t.Execute(os.Stdout, nil); err != nil {
+		panic(err)
+	}
+	// Output:
+	// <title>Tom &amp; Jerry</title>
+}
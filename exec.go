@@ -0,0 +1,645 @@
+package xt
+
+import (
+	"io"
+	"math"
+	"reflect"
+)
+
+// state represents the state of a single execution of a template
+type state struct {
+	tree *Tree
+	node Node // node currently being executed, used in error messages
+	wr   io.Writer
+	data interface{}
+	vars []variable // variables assigned while executing, e.g. loop variables
+	loop *Loop      // information about the innermost for-loop
+
+	top    map[string]interface{} // variables defined at the top level of the template, e.g. macros
+	outer  map[string]interface{} // variables of the including or importing template, shadowed by top
+	scopes int                    // number of scopes surrounding the current position, e.g. loops and macros
+
+	parent *Tree                 // template extended by the current template
+	chain  map[string]bool       // names of the templates executed so far in the chain of inheritance
+	blocks map[string][]blockDef // blocks by name, from the most derived template to the base template
+	block  *blockRef             // block currently being rendered
+
+	depth int // number of included templates and macro calls surrounding the current position
+}
+
+// maxDepth is the maximum nesting of included templates and macro calls,
+// which stops e.g. a template including itself before the stack overflows
+const maxDepth = 1000
+
+// variable holds the value of a variable assigned in the template
+type variable struct {
+	name  string
+	value interface{}
+}
+
+// push adds a new variable to the stack
+func (s *state) push(name string, value interface{}) {
+	s.vars = append(s.vars, variable{name, value})
+}
+
+// define assigns a variable at the current position. At the top level of the
+// template, the variable is visible to all macros of the template, otherwise
+// it is visible until the end of the current scope.
+func (s *state) define(name string, value interface{}) {
+	if s.scopes == 0 {
+		s.top[name] = value
+		return
+	}
+	s.push(name, value)
+}
+
+// mark returns the current height of the variable stack
+func (s *state) mark() int {
+	return len(s.vars)
+}
+
+// pop removes variables from the stack until it has the height mark
+func (s *state) pop(mark int) {
+	s.vars = s.vars[0:mark]
+}
+
+// Execute renders the parsed template against data, writing the result to w.
+// data is typically a map with string keys or a struct, and is used to look up
+// the identifiers used in the template.
+func (t *Tree) Execute(w io.Writer, data interface{}) error {
+	s := &state{
+		tree:   t,
+		wr:     w,
+		data:   data,
+		top:    make(map[string]interface{}),
+		blocks: make(map[string][]blockDef),
+	}
+	return s.executeTree(t)
+}
+
+// subState returns a new state for executing the template t, writing to w.
+// If withContext is set, t has access to the data and the variables of s.
+func (s *state) subState(t *Tree, w io.Writer, withContext bool) *state {
+	sub := &state{
+		tree:   t,
+		wr:     w,
+		top:    make(map[string]interface{}),
+		blocks: make(map[string][]blockDef),
+		depth:  s.depth + 1,
+	}
+	if withContext {
+		// the variables of the current scope shadow those at the top level,
+		// and are in turn shadowed by those defined by the template itself
+		sub.data = s.data
+		sub.outer = make(map[string]interface{}, len(s.outer)+len(s.top)+len(s.vars))
+		for name, value := range s.outer {
+			sub.outer[name] = value
+		}
+		for name, value := range s.top {
+			sub.outer[name] = value
+		}
+		for _, v := range s.vars {
+			sub.outer[v.name] = v.value
+		}
+	}
+	return sub
+}
+
+// at marks the node as the one currently being executed
+func (s *state) at(node Node) {
+	s.node = node
+}
+
+// errorf returns a runtime error at the position of the current node
+func (s *state) errorf(format string, args ...interface{}) error {
+	pos := Pos(-1)
+	if s.node != nil {
+		pos = s.node.Position()
+	}
+	return s.tree.newError(RuntimeError, pos, format, args...)
+}
+
+// walkList executes each node in nodeList in order
+func (s *state) walkList(nodeList []Node) error {
+	for _, node := range nodeList {
+		if err := s.walk(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk executes a single node
+func (s *state) walk(node Node) error {
+	s.at(node)
+	switch n := node.(type) {
+	case *TextValue:
+		_, err := io.WriteString(s.wr, n.Text)
+		return err
+	case *BlockStmt:
+		if n.Name == "" {
+			return s.walkList(n.Body)
+		}
+		return s.walkBlock(n)
+	case *ExtendsStmt:
+		return s.walkExtends(n)
+	case *IncludeStmt:
+		return s.walkInclude(n)
+	case *VarStmt:
+		val, err := s.evalExpr(n.Expression)
+		if err != nil {
+			return err
+		}
+		return s.printValue(val, n.Escapers)
+	case *AutoescapeStmt:
+		return s.walkList(n.Body)
+	case *ForStmt:
+		return s.walkFor(n)
+	case *LoopControlStmt:
+		if n.Continue {
+			return errContinue
+		}
+		return errBreak
+	case *MacroStmt:
+		s.defineMacro(n)
+		return nil
+	case *CallStmt:
+		return s.walkCall(n)
+	case *ImportStmt:
+		return s.walkImport(n)
+	case *FromImportStmt:
+		return s.walkFromImport(n)
+	case *SetStmt:
+		return s.walkSet(n)
+	case *WithStmt:
+		return s.walkWith(n)
+	case *IfStmt:
+		val, err := s.evalExpr(n.Expression)
+		if err != nil {
+			return err
+		}
+		if isTrue(val) {
+			return s.walkList(n.Body)
+		}
+		if n.Else != nil {
+			return s.walk(n.Else)
+		}
+		return nil
+	}
+	return s.errorf("cannot execute node of type %T", node)
+}
+
+// printValue writes the string representation of val to the output, escaped
+// by each of the escapers in turn. nil values are written as an empty string.
+func (s *state) printValue(val interface{}, escapers []string) error {
+	_, err := io.WriteString(s.wr, escapeValue(val, escapers))
+	return err
+}
+
+// evalExpr evaluates an expression
+func (s *state) evalExpr(node Node) (interface{}, error) {
+	s.at(node)
+	switch n := node.(type) {
+	case *StringValue:
+		return n.Val, nil
+	case *NumberValue:
+		if n.IsInt {
+			return n.Int, nil
+		}
+		return n.Float, nil
+	case *BoolValue:
+		return n.Val, nil
+	case *Identifier:
+		return s.lookup(n.Name)
+	case *AttrExpr:
+		x, err := s.evalExpr(n.X)
+		if err != nil {
+			return nil, err
+		}
+		s.at(n)
+		res, err := getAttr(x, n.Name)
+		if err != nil {
+			return nil, s.errorf("%s", err)
+		}
+		return res, nil
+	case *IndexExpr:
+		x, err := s.evalExpr(n.X)
+		if err != nil {
+			return nil, err
+		}
+		index, err := s.evalExpr(n.Index)
+		if err != nil {
+			return nil, err
+		}
+		s.at(n)
+		res, err := getItem(x, index)
+		if err != nil {
+			return nil, s.errorf("%s", err)
+		}
+		return res, nil
+	case *SliceExpr:
+		return s.evalSlice(n)
+	case *FilterExpr:
+		return s.evalFilter(n)
+	case *TestExpr:
+		return s.evalTest(n)
+	case *CallExpr:
+		return s.evalCall(n)
+	case *SuperExpr:
+		return s.evalSuper(n)
+	case *ListExpr:
+		list := make([]interface{}, len(n.Items))
+		for k := range n.Items {
+			val, err := s.evalExpr(n.Items[k])
+			if err != nil {
+				return nil, err
+			}
+			list[k] = val
+		}
+		return list, nil
+	case *DictExpr:
+		return s.evalDict(n)
+	case *UnaryExpr:
+		return s.evalUnary(n)
+	case *BinaryExpr:
+		return s.evalBinary(n)
+	}
+	return nil, s.errorf("cannot evaluate node of type %T", node)
+}
+
+// evalUnary evaluates an unary expression
+func (s *state) evalUnary(n *UnaryExpr) (interface{}, error) {
+	x, err := s.evalExpr(n.X)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == "not" {
+		return !isTrue(x), nil
+	}
+	s.at(n)
+
+	i, f, isInt, ok := toNumber(x)
+	if !ok {
+		return nil, s.errorf("unsupported operand type for unary %s: %T", n.Op, x)
+	}
+	switch {
+	case n.Op == "+" && isInt:
+		return i, nil
+	case n.Op == "+":
+		return f, nil
+	case isInt && i == math.MinInt64:
+		return nil, s.errorf("integer overflow in -(%d)", i)
+	case isInt:
+		return -i, nil
+	}
+	return -f, nil
+}
+
+// evalBinary evaluates a binary expression
+func (s *state) evalBinary(n *BinaryExpr) (interface{}, error) {
+	x, err := s.evalExpr(n.X)
+	if err != nil {
+		return nil, err
+	}
+
+	// 'and' and 'or' short-circuits, and returns the value of the last evaluated operand
+	switch {
+	case n.Op == "and" && !isTrue(x):
+		return x, nil
+	case n.Op == "or" && isTrue(x):
+		return x, nil
+	}
+
+	y, err := s.evalExpr(n.Y)
+	if err != nil {
+		return nil, err
+	}
+	s.at(n)
+
+	switch n.Op {
+	case "and", "or":
+		return y, nil
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(x, y)
+		if err != nil {
+			return nil, s.errorf("%s", err)
+		}
+		switch n.Op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in", "not in":
+		found, err := contains(y, x)
+		if err != nil {
+			return nil, s.errorf("%s", err)
+		}
+		return found == (n.Op == "in"), nil
+	}
+
+	res, err := arithmetic(n.Op, x, y)
+	if err != nil {
+		return nil, s.errorf("%s", err)
+	}
+	return res, nil
+}
+
+// evalFilter evaluates a filter expression
+func (s *state) evalFilter(n *FilterExpr) (interface{}, error) {
+	fn := s.tree.env.filter(n.Name)
+	if fn == nil {
+		return nil, s.errorf("unknown filter '%s'", n.Name)
+	}
+
+	x, err := s.evalExpr(n.X)
+	if err != nil {
+		return nil, err
+	}
+	args, err := s.evalArgs(n.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	s.at(n)
+	res, err := applyFilter(fn, x, args)
+	if err != nil {
+		return nil, s.errorf("filter '%s': %s", n.Name, err)
+	}
+	return res, nil
+}
+
+// evalTest evaluates a test expression
+func (s *state) evalTest(n *TestExpr) (interface{}, error) {
+	if n.Name == "defined" || n.Name == "undefined" {
+		defined, err := s.isDefined(n.X)
+		if err != nil {
+			return nil, err
+		}
+		return defined == (n.Name == "defined") != n.Not, nil
+	}
+
+	fn := s.tree.env.test(n.Name)
+	if fn == nil {
+		return nil, s.errorf("unknown test '%s'", n.Name)
+	}
+
+	x, err := s.evalExpr(n.X)
+	if err != nil {
+		return nil, err
+	}
+	args, err := s.evalArgs(n.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	s.at(n)
+	res, err := applyTest(fn, x, args)
+	if err != nil {
+		return nil, s.errorf("test '%s': %s", n.Name, err)
+	}
+	return res != n.Not, nil
+}
+
+// isDefined reports whether the variable, attribute or element referred to by node exists
+func (s *state) isDefined(node Node) (bool, error) {
+	var found bool
+	var err error
+	switch n := node.(type) {
+	case *Identifier:
+		_, found, err = s.lookupVar(n.Name)
+	case *AttrExpr:
+		var x interface{}
+		x, err = s.evalExpr(n.X)
+		if err == nil {
+			_, found, err = lookupAttr(x, n.Name)
+		}
+	case *IndexExpr:
+		var x, index interface{}
+		x, err = s.evalExpr(n.X)
+		if err == nil {
+			index, err = s.evalExpr(n.Index)
+		}
+		if err == nil {
+			_, found, err = lookupItem(x, index)
+		}
+	default:
+		return true, nil
+	}
+	if err != nil {
+		return false, s.errorf("%s", err)
+	}
+	return found, nil
+}
+
+// evalCall evaluates a function call
+func (s *state) evalCall(n *CallExpr) (interface{}, error) {
+	return s.evalCallWith(n, nil)
+}
+
+// evalCallWith evaluates a function call. If caller is set, the function
+// must be a macro, and caller is passed to the macro as 'caller'.
+func (s *state) evalCallWith(n *CallExpr, caller *macro) (interface{}, error) {
+	fn, err := s.evalFunc(n.Func)
+	if err != nil {
+		return nil, err
+	}
+	args, err := s.evalArgs(n.Args)
+	if err != nil {
+		return nil, err
+	}
+	kwargs, err := s.evalArgs(n.Kwargs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.at(n)
+	if m, ok := fn.(*macro); ok {
+		return s.callMacro(m, args, n.KwargNames, kwargs, caller)
+	}
+	if caller != nil {
+		return nil, s.errorf("only macros can be called with a call block, not %T", fn)
+	}
+
+	var kw Kwargs
+	if len(kwargs) > 0 {
+		kw = make(Kwargs, len(kwargs))
+		for k, name := range n.KwargNames {
+			kw[name] = kwargs[k]
+		}
+	}
+	res, err := callFunc(fn, args, kw)
+	if err != nil {
+		if name := funcName(n.Func); name != "" {
+			return nil, s.errorf("%s: %s", name, err)
+		}
+		return nil, s.errorf("%s", err)
+	}
+	return res, nil
+}
+
+// funcName returns the name of the function in a call, e.g. 'url_for' in
+// 'url_for("user")' or 'FullName' in 'user.FullName()', or "" if the
+// function has no name
+func funcName(node Node) string {
+	switch n := node.(type) {
+	case *Identifier:
+		return n.Name
+	case *AttrExpr:
+		return n.Name
+	}
+	return ""
+}
+
+// evalFunc evaluates the function of a call. Methods are not called when
+// they are looked up as attributes, so that 'user.FullName()' calls the
+// method FullName with the arguments of the call.
+func (s *state) evalFunc(node Node) (interface{}, error) {
+	attr, ok := node.(*AttrExpr)
+	if !ok {
+		return s.evalExpr(node)
+	}
+	x, err := s.evalExpr(attr.X)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := getMethod(x, attr.Name); ok {
+		return m, nil
+	}
+	s.at(attr)
+	res, err := getAttr(x, attr.Name)
+	if err != nil {
+		return nil, s.errorf("%s", err)
+	}
+	return res, nil
+}
+
+// evalArgs evaluates the arguments of a filter, test or function call
+func (s *state) evalArgs(nodes []Node) ([]interface{}, error) {
+	args := make([]interface{}, len(nodes))
+	for k := range nodes {
+		var err error
+		args[k], err = s.evalExpr(nodes[k])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// evalDict evaluates a dict literal. If all keys are strings, the result
+// is a map[string]interface{}, otherwise a map[interface{}]interface{}
+func (s *state) evalDict(n *DictExpr) (interface{}, error) {
+	keys := make([]interface{}, len(n.Keys))
+	values := make([]interface{}, len(n.Values))
+	stringKeys := true
+	for k := range n.Keys {
+		var err error
+		keys[k], err = s.evalExpr(n.Keys[k])
+		if err != nil {
+			return nil, err
+		}
+		values[k], err = s.evalExpr(n.Values[k])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := keys[k].(string); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		dict := make(map[string]interface{}, len(keys))
+		for k := range keys {
+			dict[keys[k].(string)] = values[k]
+		}
+		return dict, nil
+	}
+
+	dict := make(map[interface{}]interface{}, len(keys))
+	for k := range keys {
+		if keys[k] != nil && !reflect.TypeOf(keys[k]).Comparable() {
+			return nil, s.errorf("unhashable dict key of type %T", keys[k])
+		}
+		dict[keys[k]] = values[k]
+	}
+	return dict, nil
+}
+
+// evalSlice evaluates a slice expression
+func (s *state) evalSlice(n *SliceExpr) (interface{}, error) {
+	x, err := s.evalExpr(n.X)
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds [3]*int64
+	for k, node := range []Node{n.Low, n.High, n.Step} {
+		if node == nil {
+			continue
+		}
+		val, err := s.evalExpr(node)
+		if err != nil {
+			return nil, err
+		}
+		i, _, isInt, ok := toNumber(val)
+		if !ok || !isInt {
+			return nil, s.errorf("slice indices must be integers, not %T", val)
+		}
+		bounds[k] = &i
+	}
+
+	s.at(n)
+	res, err := sliceValue(x, bounds[0], bounds[1], bounds[2])
+	if err != nil {
+		return nil, s.errorf("%s", err)
+	}
+	return res, nil
+}
+
+// lookup returns the value of the variable name.
+// Unknown names evaluate to nil.
+func (s *state) lookup(name string) (interface{}, error) {
+	res, _, err := s.lookupVar(name)
+	return res, err
+}
+
+// lookupVar returns the value of the variable name, and reports whether it exists.
+// Variables are looked up in the following order:
+//
+//	variables assigned in the template, e.g. loop variables
+//	variables defined at the top level of the template, e.g. macros
+//	variables of the including template, if included with context
+//	the data supplied to Execute
+//	global variables and functions of the environment
+func (s *state) lookupVar(name string) (interface{}, bool, error) {
+	for i := len(s.vars) - 1; i >= 0; i-- {
+		if s.vars[i].name == name {
+			return s.vars[i].value, true, nil
+		}
+	}
+	if res, ok := s.top[name]; ok {
+		return res, true, nil
+	}
+	if res, ok := s.outer[name]; ok {
+		return res, true, nil
+	}
+
+	res, found, err := lookupAttr(s.data, name)
+	if err != nil {
+		return nil, false, s.errorf("%s", err)
+	}
+	if found {
+		return res, true, nil
+	}
+
+	res, found = s.tree.env.global(name)
+	return res, found, nil
+}
@@ -0,0 +1,91 @@
+package xt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// execTest is a template executed with data, together with the expected
+// output, or a part of the expected error message if err is set
+type execTest struct {
+	name string
+	tmpl string
+	data interface{}
+	want string
+	err  string
+}
+
+// newTestEnv creates an environment loading the templates from templates
+func newTestEnv(templates map[string]string) *Environment {
+	env := NewEnvironment()
+	env.SetLoader(MapLoader(templates))
+	return env
+}
+
+// render parses src as the template name in env, and executes it with data
+func render(env *Environment, name, src string, data interface{}) (string, error) {
+	tree := env.NewTree(name)
+	if err := tree.Parse(src); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	err := tree.Execute(&sb, data)
+	return sb.String(), err
+}
+
+// runExecTests renders each of tests in env, using the name of the test
+// as the name of the template, and compares the output or error
+func runExecTests(t *testing.T, env *Environment, tests []execTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := render(env, test.name, test.tmpl, test.data)
+			switch {
+			case test.err != "" && err == nil:
+				t.Fatalf("expected error containing %q, got output %q", test.err, got)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Fatalf("expected error containing %q, got %q", test.err, err)
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case test.err == "" && got != test.want:
+				t.Fatalf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+// timeout runs fn, and fails the test if fn does not return within a second,
+// e.g. if parsing or executing a template never ends
+func timeout(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+type execUser struct {
+	Name  string
+	Admin bool
+}
+
+func TestExecute(t *testing.T) {
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "text", tmpl: "hello, world", want: "hello, world"},
+		{name: "empty", tmpl: "", want: ""},
+		{name: "map", tmpl: "{% if admin %}admin{% endif %}", data: map[string]interface{}{"admin": true}, want: "admin"},
+		{name: "struct", tmpl: "{% if Admin %}admin{% else %}user{% endif %}", data: execUser{Name: "a"}, want: "user"},
+		{name: "pointer", tmpl: "{% if Admin %}admin{% endif %}", data: &execUser{Admin: true}, want: "admin"},
+		{name: "unknown variable", tmpl: "{% if missing %}x{% else %}y{% endif %}", want: "y"},
+		{name: "elif", tmpl: "{% if a %}a{% elif b %}b{% else %}c{% endif %}", data: map[string]bool{"b": true}, want: "b"},
+		{name: "block", tmpl: "{% block b %}x{% endblock %}", want: "x"},
+		{name: "nil data", tmpl: "{% if x %}x{% endif %}y", data: nil, want: "y"},
+	})
+}
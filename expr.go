@@ -0,0 +1,682 @@
+package xt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumberValue represents a numeric constant in an expression.
+// Integers are stored in Int, with IsInt set, other numbers in Float.
+type NumberValue struct {
+	Start Pos
+	Text  string
+	IsInt bool
+	Int   int64
+	Float float64
+}
+
+// Position returns the start position of the statement
+func (s *NumberValue) Position() Pos { return s.Start }
+
+// BoolValue represents a boolean constant ('true' or 'false') in an expression
+type BoolValue struct {
+	Start Pos
+	Val   bool
+}
+
+// Position returns the start position of the statement
+func (s *BoolValue) Position() Pos { return s.Start }
+
+// UnaryExpr represents an unary operation, like 'not x' or '-x'
+type UnaryExpr struct {
+	Start Pos
+	Op    string
+	X     Node
+}
+
+// Position returns the start position of the statement
+func (s *UnaryExpr) Position() Pos { return s.Start }
+
+// BinaryExpr represents a binary operation, like 'x == y', 'x and y' or 'x + y'
+type BinaryExpr struct {
+	Start Pos
+	Op    string
+	X     Node
+	Y     Node
+}
+
+// Position returns the start position of the statement
+func (s *BinaryExpr) Position() Pos { return s.Start }
+
+// AttrExpr represents attribute access, like 'user.name'
+type AttrExpr struct {
+	Start Pos
+	X     Node
+	Name  string
+}
+
+// Position returns the start position of the statement
+func (s *AttrExpr) Position() Pos { return s.Start }
+
+// IndexExpr represents a subscript, like 'items[0]' or 'user["name"]'
+type IndexExpr struct {
+	Start Pos
+	X     Node
+	Index Node
+}
+
+// Position returns the start position of the statement
+func (s *IndexExpr) Position() Pos { return s.Start }
+
+// SliceExpr represents a slice, like 's[1:3]' or 's[::-1]'.
+// Low, High and Step are nil if they were not specified.
+type SliceExpr struct {
+	Start Pos
+	X     Node
+	Low   Node
+	High  Node
+	Step  Node
+}
+
+// Position returns the start position of the statement
+func (s *SliceExpr) Position() Pos { return s.Start }
+
+// FilterExpr represents a filter applied to a value, like 'name | upper' or 'text | truncate(20)'
+type FilterExpr struct {
+	Start Pos
+	X     Node
+	Name  string
+	Args  []Node
+}
+
+// Position returns the start position of the statement
+func (s *FilterExpr) Position() Pos { return s.Start }
+
+// TestExpr represents a test of a value, like 'x is defined' or 'n is not divisibleby(3)'
+type TestExpr struct {
+	Start Pos
+	X     Node
+	Name  string
+	Args  []Node
+	Not   bool
+}
+
+// Position returns the start position of the statement
+func (s *TestExpr) Position() Pos { return s.Start }
+
+// CallExpr represents a function call, like 'range(10)' or 'field("email", type="email")'.
+// The keyword arguments are in KwargNames and Kwargs, in the order given.
+type CallExpr struct {
+	Start      Pos
+	Func       Node
+	Args       []Node
+	KwargNames []string
+	Kwargs     []Node
+}
+
+// Position returns the start position of the statement
+func (s *CallExpr) Position() Pos { return s.Start }
+
+// ListExpr represents a list literal, like '["a", "b"]'
+type ListExpr struct {
+	Start Pos
+	Items []Node
+}
+
+// Position returns the start position of the statement
+func (s *ListExpr) Position() Pos { return s.Start }
+
+// DictExpr represents a dict literal, like '{"a": 1, "b": 2}'
+type DictExpr struct {
+	Start  Pos
+	Keys   []Node
+	Values []Node
+}
+
+// Position returns the start position of the statement
+func (s *DictExpr) Position() Pos { return s.Start }
+
+// expression parses a complete expression, which must be followed by the token type end
+func (t *Tree) expression(end itemType) (Node, error) {
+	n, err := t.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if token := t.next(); token.typ == itemError {
+		return nil, t.errorf("%s", token.val)
+	} else if token.typ != end {
+		return nil, t.errorf("unexpected token in expression: %s", token)
+	}
+	return n, nil
+}
+
+// parseExpr parses an expression. The precedence of the operators, from
+// lowest to highest, is:
+//  or
+//  and
+//  not
+//  in, not in, ==, !=, <, <=, >, >=
+//  +, -
+//  *, /, //, %
+//  unary +, unary -
+//  x.attr, x[index], x[low:high:step], x | filter, x is test, x(args)
+func (t *Tree) parseExpr() (Node, error) {
+	return t.parseOr()
+}
+
+// isWord reports whether token is the identifier or keyword word
+func isWord(token item, word string) bool {
+	return (token.typ == itemIdentifier || token.typ > itemKeyword) && token.val == word
+}
+
+// isChar reports whether token is the character c
+func isChar(token item, c string) bool {
+	return token.typ == itemChar && token.val == c
+}
+
+// parseOr parses 'x or y'
+func (t *Tree) parseOr() (Node, error) {
+	x, err := t.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isWord(t.peek(), "or") {
+		t.next()
+		y, err := t.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Start: x.Position(), Op: "or", X: x, Y: y}
+	}
+	return x, nil
+}
+
+// parseAnd parses 'x and y'
+func (t *Tree) parseAnd() (Node, error) {
+	x, err := t.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for isWord(t.peek(), "and") {
+		t.next()
+		y, err := t.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Start: x.Position(), Op: "and", X: x, Y: y}
+	}
+	return x, nil
+}
+
+// parseNot parses 'not x'
+func (t *Tree) parseNot() (Node, error) {
+	if token := t.peek(); isWord(token, "not") {
+		t.next()
+		x, err := t.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Start: token.pos, Op: "not", X: x}, nil
+	}
+	return t.parseComparison()
+}
+
+// parseComparison parses comparisons and membership tests, e.g. 'x < y' and 'x not in y'
+func (t *Tree) parseComparison() (Node, error) {
+	x, err := t.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		token := t.next()
+		switch {
+		case token.typ == itemComparison:
+			op = token.val
+		case isWord(token, "in"):
+			op = "in"
+		case isWord(token, "not") && isWord(t.peek(), "in"):
+			t.next()
+			op = "not in"
+		default:
+			t.backup(token)
+			return x, nil
+		}
+
+		y, err := t.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Start: x.Position(), Op: op, X: x, Y: y}
+	}
+}
+
+// parseAdditive parses 'x + y' and 'x - y'
+func (t *Tree) parseAdditive() (Node, error) {
+	x, err := t.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for token := t.peek(); token.typ == itemOperator &&
+		(token.val == "+" || token.val == "-"); token = t.peek() {
+		t.next()
+		y, err := t.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Start: x.Position(), Op: token.val, X: x, Y: y}
+	}
+	return x, nil
+}
+
+// parseMultiplicative parses 'x * y', 'x / y', 'x // y' and 'x % y'
+func (t *Tree) parseMultiplicative() (Node, error) {
+	x, err := t.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for token := t.peek(); token.typ == itemOperator &&
+		token.val != "+" && token.val != "-"; token = t.peek() {
+		t.next()
+		y, err := t.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Start: x.Position(), Op: token.val, X: x, Y: y}
+	}
+	return x, nil
+}
+
+// parseUnary parses '-x' and '+x'
+func (t *Tree) parseUnary() (Node, error) {
+	if token := t.peek(); token.typ == itemOperator &&
+		(token.val == "+" || token.val == "-") {
+		t.next()
+		// the smallest integer is only in range when negated
+		if num := t.peek(); token.val == "-" && num.typ == itemNumber {
+			if i, err := strconv.ParseInt("-"+num.val, 0, 64); err == nil && i == math.MinInt64 {
+				t.next()
+				return t.parsePostfixOf(&NumberValue{Start: token.pos, Text: "-" + num.val, IsInt: true, Int: i, Float: float64(i)})
+			}
+		}
+		x, err := t.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Start: token.pos, Op: token.val, X: x}, nil
+	}
+	return t.parsePostfix()
+}
+
+// parsePostfix parses attribute access, subscripts, slices, filters, tests and calls
+func (t *Tree) parsePostfix() (Node, error) {
+	x, err := t.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return t.parsePostfixOf(x)
+}
+
+// parsePostfixOf parses the attribute access, subscripts, slices, filters,
+// tests and calls following the expression x
+func (t *Tree) parsePostfixOf(x Node) (Node, error) {
+	var err error
+	for {
+		token := t.peek()
+		switch {
+		case token.typ == itemField:
+			t.next()
+			x = &AttrExpr{Start: x.Position(), X: x, Name: token.val[1:]}
+		case isChar(token, "["):
+			t.next()
+			x, err = t.parseSubscript(x)
+			if err != nil {
+				return nil, err
+			}
+		case token.typ == itemPipe:
+			t.next()
+			x, err = t.parseFilter(x)
+			if err != nil {
+				return nil, err
+			}
+		case isWord(token, "is"):
+			t.next()
+			x, err = t.parseTest(x)
+			if err != nil {
+				return nil, err
+			}
+		case token.typ == itemLeftParen:
+			t.next()
+			x, err = t.parseCall(x)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseSubscript parses the contents of a subscript, after the opening '['
+//  x[index]
+//  x[low:high]
+//  x[low:high:step]
+func (t *Tree) parseSubscript(x Node) (Node, error) {
+	var parts []Node
+	var err error
+	for i := 0; i < 3; i++ {
+		var n Node
+		if token := t.peek(); !isChar(token, ":") && !isChar(token, "]") {
+			n, err = t.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+		}
+		parts = append(parts, n)
+
+		token := t.next()
+		if isChar(token, "]") {
+			break
+		}
+		if !isChar(token, ":") || i == 2 {
+			return nil, t.errorf("expected ']', got %s", token)
+		}
+	}
+
+	if len(parts) == 1 {
+		if parts[0] == nil {
+			return nil, t.errorf("missing index in subscript")
+		}
+		return &IndexExpr{Start: x.Position(), X: x, Index: parts[0]}, nil
+	}
+
+	slice := &SliceExpr{Start: x.Position(), X: x, Low: parts[0], High: parts[1]}
+	if len(parts) == 3 {
+		slice.Step = parts[2]
+	}
+	return slice, nil
+}
+
+// parseFilter parses a filter applied to x, after the '|'
+//  x | name
+//  x | name(arg1, arg2...)
+func (t *Tree) parseFilter(x Node) (Node, error) {
+	name := t.next()
+	if name.typ != itemIdentifier {
+		return nil, t.errorf("expected filter name, got %s", name)
+	}
+	if t.env.filter(name.val) == nil {
+		return nil, t.errorf("unknown filter '%s'", name.val)
+	}
+
+	filter := &FilterExpr{Start: x.Position(), X: x, Name: name.val}
+	if t.peek().typ != itemLeftParen {
+		return filter, nil
+	}
+	t.next()
+
+	var err error
+	filter.Args, err = t.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseTest parses a test applied to x, after the 'is'
+//  x is [not] name
+//  x is [not] name(arg1, arg2...)
+//  x is [not] name constant
+func (t *Tree) parseTest(x Node) (Node, error) {
+	test := &TestExpr{Start: x.Position(), X: x}
+	name := t.next()
+	if isWord(name, "not") {
+		test.Not = true
+		name = t.next()
+	}
+	if name.typ != itemIdentifier {
+		return nil, t.errorf("expected test name, got %s", name)
+	}
+	if name.val != "defined" && name.val != "undefined" && t.env.test(name.val) == nil {
+		return nil, t.errorf("unknown test '%s'", name.val)
+	}
+	test.Name = name.val
+
+	var err error
+	switch token := t.peek(); token.typ {
+	case itemLeftParen:
+		t.next()
+		test.Args, err = t.parseArgs()
+	case itemNumber, itemString, itemBool:
+		// a single constant can be given without parentheses
+		var arg Node
+		arg, err = t.parsePrimary()
+		test.Args = []Node{arg}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+// parseArgs parses a comma separated list of arguments of a filter or test,
+// after the opening '(' and up to and including the closing ')'.
+// Filters and tests only take positional arguments.
+func (t *Tree) parseArgs() ([]Node, error) {
+	args := []Node{}
+	if t.peek().typ == itemRightParen {
+		t.next()
+		return args, nil
+	}
+	for {
+		arg, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		token := t.next()
+		if token.typ == itemRightParen {
+			return args, nil
+		}
+		if token.typ == itemAssign {
+			return nil, t.errorf("filters and tests do not take keyword arguments")
+		}
+		if !isChar(token, ",") {
+			return nil, t.errorf("expected ',' or ')', got %s", token)
+		}
+	}
+}
+
+// parseCall parses the arguments of a call of fn, after the opening '('
+// and up to and including the closing ')'. Keyword arguments must follow
+// the positional arguments.
+//  fn(arg1, arg2..., name1=arg, name2=arg...)
+func (t *Tree) parseCall(fn Node) (*CallExpr, error) {
+	call := &CallExpr{Start: fn.Position(), Func: fn, Args: []Node{}}
+	if t.peek().typ == itemRightParen {
+		t.next()
+		return call, nil
+	}
+	for {
+		// a keyword argument is an identifier followed by '='
+		name := t.next()
+		if name.typ == itemIdentifier && t.peek().typ == itemAssign {
+			t.next()
+			for _, kw := range call.KwargNames {
+				if kw == name.val {
+					return nil, t.newError(SyntaxError, name.pos, "keyword argument '%s' repeated", name.val)
+				}
+			}
+			arg, err := t.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.KwargNames = append(call.KwargNames, name.val)
+			call.Kwargs = append(call.Kwargs, arg)
+		} else {
+			if len(call.Kwargs) > 0 {
+				return nil, t.newError(SyntaxError, name.pos, "positional argument follows keyword argument")
+			}
+			t.backup(name)
+			arg, err := t.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+		}
+
+		token := t.next()
+		if token.typ == itemRightParen {
+			return call, nil
+		}
+		if !isChar(token, ",") {
+			return nil, t.errorf("expected ',' or ')', got %s", token)
+		}
+	}
+}
+
+// parsePrimary parses constants, identifiers, list and dict literals and parenthesized expressions
+func (t *Tree) parsePrimary() (Node, error) {
+	token := t.next()
+	switch token.typ {
+	case itemString:
+		val, err := unquote(token.val)
+		if err != nil {
+			return nil, t.errorf("%s", err)
+		}
+		return &StringValue{Start: token.pos, Val: val}, nil
+	case itemNumber:
+		return t.newNumber(token)
+	case itemBool:
+		return &BoolValue{Start: token.pos, Val: token.val == "true"}, nil
+	case itemIdentifier:
+		if token.val == "super" && t.peek().typ == itemLeftParen {
+			return t.newSuperExpr(token)
+		}
+		return &Identifier{Start: token.pos, Name: token.val}, nil
+	case itemLeftParen:
+		x, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if token := t.next(); token.typ != itemRightParen {
+			return nil, t.errorf("expected right paren, got %s", token)
+		}
+		return x, nil
+	case itemChar:
+		if token.val == "[" {
+			return t.parseList(token)
+		} else if token.val == "{" {
+			return t.parseDict(token)
+		}
+	case itemEOF:
+		return nil, t.errorf("expected expression, got EOF")
+	case itemError:
+		return nil, t.errorf("%s", token.val)
+	}
+	return nil, t.errorf("unexpected token in expression: %s", token)
+}
+
+// parseList parses a list literal, after the opening '['
+//  [expression, expression...]
+func (t *Tree) parseList(start item) (Node, error) {
+	list := &ListExpr{Start: start.pos, Items: []Node{}}
+	for !isChar(t.peek(), "]") {
+		n, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, n)
+
+		if token := t.peek(); !isChar(token, ",") && !isChar(token, "]") {
+			return nil, t.errorf("expected ',' or ']', got %s", token)
+		} else if isChar(token, ",") {
+			t.next()
+		}
+	}
+	t.next()
+	return list, nil
+}
+
+// parseDict parses a dict literal, after the opening '{'
+//  {expression: expression, expression: expression...}
+func (t *Tree) parseDict(start item) (Node, error) {
+	dict := &DictExpr{Start: start.pos}
+	for !isChar(t.peek(), "}") {
+		key, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if token := t.next(); !isChar(token, ":") {
+			return nil, t.errorf("expected ':', got %s", token)
+		}
+		value, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		dict.Keys = append(dict.Keys, key)
+		dict.Values = append(dict.Values, value)
+
+		if token := t.peek(); !isChar(token, ",") && !isChar(token, "}") {
+			return nil, t.errorf("expected ',' or '}', got %s", token)
+		} else if isChar(token, ",") {
+			t.next()
+		}
+	}
+	t.next()
+	return dict, nil
+}
+
+// newNumber converts a number token to a NumberValue
+func (t *Tree) newNumber(token item) (Node, error) {
+	n := &NumberValue{Start: token.pos, Text: token.val}
+	if i, err := strconv.ParseInt(token.val, 0, 64); err == nil {
+		n.IsInt = true
+		n.Int = i
+		n.Float = float64(i)
+		return n, nil
+	} else if errors.Is(err, strconv.ErrRange) {
+		return nil, t.errorf("integer %s out of range", token.val)
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(token.val, "_", ""), 64)
+	if err != nil {
+		return nil, t.errorf("invalid number %s", token.val)
+	}
+	n.Float = f
+	return n, nil
+}
+
+// unquote removes the surrounding quotes from a string literal, and
+// interprets any escape sequences within it
+func unquote(s string) (string, error) {
+	if len(s) < 2 {
+		return "", fmt.Errorf("invalid string literal %s", s)
+	}
+	s = s[1 : len(s)-1]
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			buf = append(buf, c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			buf = append(buf, '\n')
+		case 't':
+			buf = append(buf, '\t')
+		case 'r':
+			buf = append(buf, '\r')
+		case '\\', '"', '\'':
+			buf = append(buf, s[i])
+		default:
+			buf = append(buf, '\\', s[i])
+		}
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,65 @@
+package xt
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpressions(t *testing.T) {
+	data := map[string]interface{}{
+		"a":     3,
+		"b":     4,
+		"s":     "abc",
+		"empty": "",
+		"list":  []int{1, 2, 3},
+		"max":   int64(math.MaxInt64),
+		"min":   int64(math.MinInt64),
+		"umax":  uint64(math.MaxUint64),
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "addition", tmpl: "{{ 1 + 2 }}", want: "3"},
+		{name: "precedence", tmpl: "{{ 1 + 2 * 3 }}", want: "7"},
+		{name: "parentheses", tmpl: "{{ (1 + 2) * 3 }}", want: "9"},
+		{name: "unary minus", tmpl: "{{ -a + 1 }}", data: data, want: "-2"},
+		{name: "division", tmpl: "{{ 7 / 2 }}", want: "3.5"},
+		{name: "floor division", tmpl: "{{ 7 // 2 }} {{ -7 // 2 }}", want: "3 -4"},
+		{name: "modulo", tmpl: "{{ 7 % 3 }} {{ -7 % 3 }}", want: "1 2"},
+		{name: "float arithmetic", tmpl: "{{ 1.5 + 1 }}", want: "2.5"},
+		{name: "string concatenation", tmpl: `{{ s + "def" }}`, data: data, want: "abcdef"},
+		{name: "comparison", tmpl: "{{ a < b }} {{ a >= b }} {{ a == 3 }} {{ a != 3 }}", data: data, want: "true false true false"},
+		{name: "mixed number comparison", tmpl: "{{ 3 == 3.0 }}", want: "true"},
+		{name: "string comparison", tmpl: `{{ "a" < "b" }}`, want: "true"},
+		{name: "and or", tmpl: "{{ a and b }} {{ empty or s }} {{ empty and s }}", data: data, want: "4 abc "},
+		{name: "not", tmpl: "{{ not empty }} {{ not a }}", data: data, want: "true false"},
+		{name: "not precedence", tmpl: "{{ not a == b }}", data: data, want: "true"},
+		{name: "in", tmpl: `{{ 2 in list }} {{ 5 not in list }} {{ "b" in s }}`, data: data, want: "true true true"},
+		{name: "bool literals", tmpl: "{{ true and not false }}", want: "true"},
+		{name: "list literal", tmpl: `{{ [1, "a"] }}`, want: "[1 a]"},
+		{name: "dict literal", tmpl: `{{ {"a": 1}.a }}`, want: "1"},
+		{name: "hex number", tmpl: "{{ 0x10 }}", want: "16"},
+		{name: "string escapes", tmpl: `{{ "a\"b" }}`, want: `a"b`},
+		{name: "if expression", tmpl: "{% if a * 2 > b and s %}yes{% endif %}", data: data, want: "yes"},
+		{name: "largest integer", tmpl: "{{ 9223372036854775807 }} {{ max - 1 + 1 }}", data: data, want: "9223372036854775807 9223372036854775807"},
+		{name: "smallest integer", tmpl: "{{ -9223372036854775808 }} {{ -9223372036854775808 + 1 }} {{ -0x8000000000000000 }}", want: "-9223372036854775808 -9223372036854775807 -9223372036854775808"},
+		{name: "smallest integer filter", tmpl: "{{ -9223372036854775808 | int }}", want: "-9223372036854775808"},
+		{name: "large floats", tmpl: "{{ 1e30 * 10 }} {{ max + 1.0 }}", data: data, want: "1e+31 9.223372036854776e+18"},
+		{name: "large unsigned", tmpl: "{{ umax > max }} {{ umax + 0 }}", data: data, want: "true 1.8446744073709552e+19"},
+		{name: "no overflow", tmpl: "{{ min + max }} {{ max * -1 }} {{ min // 1 }} {{ min % -1 }}", data: data, want: "-1 -9223372036854775807 -9223372036854775808 0"},
+		{name: "addition overflow", tmpl: "{{ 9223372036854775807 + 1 }}", err: ":1:4: integer overflow in 9223372036854775807 + 1"},
+		{name: "negative addition overflow", tmpl: "{{ min + -1 }}", data: data, err: "integer overflow in -9223372036854775808 + -1"},
+		{name: "subtraction overflow", tmpl: "{{ min - 1 }}", data: data, err: "integer overflow in -9223372036854775808 - 1"},
+		{name: "negative subtraction overflow", tmpl: "{{ max - -1 }}", data: data, err: "integer overflow in 9223372036854775807 - -1"},
+		{name: "multiplication overflow", tmpl: "{{ max * 2 }}", data: data, err: "integer overflow in 9223372036854775807 * 2"},
+		{name: "negative multiplication overflow", tmpl: "{{ -1 * min }} {{ min * -1 }}", data: data, err: "integer overflow in -1 * -9223372036854775808"},
+		{name: "floor division overflow", tmpl: "{{ min // -1 }}", data: data, err: "integer overflow in -9223372036854775808 // -1"},
+		{name: "negation overflow", tmpl: "{{ -min }}", data: data, err: ":1:4: integer overflow in -(-9223372036854775808)"},
+		{name: "literal out of range", tmpl: "{{ 9223372036854775808 }}", err: ":1:4: integer 9223372036854775808 out of range"},
+		{name: "negative literal out of range", tmpl: "{{ -9223372036854775809 }}", err: "integer 9223372036854775809 out of range"},
+		{name: "division by zero", tmpl: "{{ a / 0 }}", data: data, err: ":1:4: division by zero"},
+		{name: "bad operands", tmpl: `{{ a - "x" }}`, data: data, err: "unsupported operand types"},
+		{name: "bad comparison", tmpl: `{{ a < "x" }}`, data: data, err: "cannot compare"},
+		{name: "missing operand", tmpl: "{{ 1 + }}", err: "1:"},
+		{name: "unbalanced parenthesis", tmpl: "{{ (1 + 2 }}", err: "missing right paren"},
+		{name: "trailing tokens", tmpl: "{{ a b }}", err: "unexpected token"},
+	})
+}
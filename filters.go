@@ -0,0 +1,482 @@
+package xt
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FilterFunc is a function that can be applied to a value in a template,
+// e.g. '{{ name | upper }}'. value is the value the filter is applied to,
+// and args contains the arguments given to the filter, if any. Arguments
+// are positional, e.g. '{{ text | truncate(20, true) }}'.
+type FilterFunc func(value interface{}, args ...interface{}) (interface{}, error)
+
+// builtinFilters are the filters available in every environment
+var builtinFilters = map[string]FilterFunc{
+	"date":     filterDate,
+	"default":  filterDefault,
+	"escape":   filterEscape,
+	"first":    filterFirst,
+	"float":    filterFloat,
+	"int":      filterInt,
+	"join":     filterJoin,
+	"last":     filterLast,
+	"length":   filterLength,
+	"lower":    filterLower,
+	"replace":  filterReplace,
+	"reverse":  filterReverse,
+	"round":    filterRound,
+	"safe":     filterSafe,
+	"sort":     filterSort,
+	"title":    filterTitle,
+	"trim":     filterTrim,
+	"truncate": filterTruncate,
+	"upper":    filterUpper,
+}
+
+// applyFilter applies the filter fn to value. If fn panics, the panic is
+// recovered and returned as an error.
+func applyFilter(fn FilterFunc, value interface{}, args []interface{}) (res interface{}, err error) {
+	defer recoverPanic(&err)
+	return fn(value, args...)
+}
+
+// checkArgs returns an error if the number of arguments is not between min and max
+func checkArgs(args []interface{}, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("expected %d arguments, got %d", min, len(args))
+		}
+		return fmt.Errorf("expected %d to %d arguments, got %d", min, max, len(args))
+	}
+	return nil
+}
+
+// intArg returns argument i as an integer, or def if it was not specified
+func intArg(args []interface{}, i int, def int) (int, error) {
+	if i >= len(args) {
+		return def, nil
+	}
+	n, _, isInt, ok := toNumber(args[i])
+	if !ok || !isInt {
+		return 0, fmt.Errorf("argument %d must be an integer, got %T", i+1, args[i])
+	}
+	return int(n), nil
+}
+
+// stringArg returns argument i as a string, or def if it was not specified
+func stringArg(args []interface{}, i int, def string) string {
+	if i >= len(args) {
+		return def
+	}
+	return toText(args[i])
+}
+
+// boolArg returns the truth value of argument i, or def if it was not specified
+func boolArg(args []interface{}, i int, def bool) bool {
+	if i >= len(args) {
+		return def
+	}
+	return isTrue(args[i])
+}
+
+// filterUpper converts a value to uppercase
+func filterUpper(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(toText(value)), nil
+}
+
+// filterLower converts a value to lowercase
+func filterLower(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return strings.ToLower(toText(value)), nil
+}
+
+// filterTitle converts the first character of every word to uppercase, and
+// the remaining characters to lowercase
+func filterTitle(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) || prev == '-' {
+			return unicode.ToTitle(r)
+		}
+		return unicode.ToLower(r)
+	}, toText(value)), nil
+}
+
+// filterTrim removes leading and trailing whitespace, or if an argument is given,
+// the characters in that argument
+//  value | trim([chars])
+func filterTrim(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return strings.Trim(toText(value), toText(args[0])), nil
+	}
+	return strings.TrimSpace(toText(value)), nil
+}
+
+// filterTruncate shortens a string to length characters, including the
+// string end which is appended to truncated strings. Unless killwords is true,
+// the string is truncated at the last word boundary. length defaults to 255,
+// killwords to false and end to "...". A negative length is handled as 0.
+//  value | truncate([length[, killwords[, end]]])
+func filterTruncate(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 3); err != nil {
+		return nil, err
+	}
+	length, err := intArg(args, 0, 255)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		length = 0
+	}
+	killwords := boolArg(args, 1, false)
+	end := stringArg(args, 2, "...")
+
+	s := []rune(toText(value))
+	if len(s) <= length {
+		return string(s), nil
+	}
+
+	n := length - len([]rune(end))
+	if n < 0 {
+		n = 0
+	}
+	res := string(s[:n])
+	// unless we're already at a word boundary, remove the partial word at the end
+	if !killwords && !unicode.IsSpace(s[n]) {
+		if i := strings.LastIndexFunc(res, unicode.IsSpace); i > 0 {
+			res = strings.TrimRightFunc(res[:i], unicode.IsSpace)
+		}
+	}
+	return res + end, nil
+}
+
+// filterDefault returns def if value is undefined or nil. If boolean is true,
+// def is also returned if value evaluates to false. def defaults to "".
+//  value | default([def[, boolean]])
+func filterDefault(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 2); err != nil {
+		return nil, err
+	}
+	if value == nil || (boolArg(args, 1, false) && !isTrue(value)) {
+		if len(args) == 0 {
+			return "", nil
+		}
+		return args[0], nil
+	}
+	return value, nil
+}
+
+// filterLength returns the number of elements in a sequence or map,
+// or the number of characters in a string
+func filterLength(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	v := indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0, nil
+	case reflect.String:
+		return len([]rune(v.String())), nil
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return v.Len(), nil
+	}
+	return nil, fmt.Errorf("%T has no length", value)
+}
+
+// filterJoin concatenates the elements of a sequence, separated by sep,
+// which defaults to ""
+//  value | join([sep])
+func filterJoin(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	elements, err := iterate(value)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(elements))
+	for k := range elements {
+		parts[k] = toText(elements[k][0])
+	}
+	return strings.Join(parts, stringArg(args, 0, "")), nil
+}
+
+// filterReplace replaces occurrences of old with new. If count is given,
+// only the first count occurrences are replaced
+//  value | replace(old, new[, count])
+func filterReplace(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	count, err := intArg(args, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Replace(toText(value), toText(args[0]), toText(args[1]), count), nil
+}
+
+// filterFirst returns the first element of a sequence
+func filterFirst(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	seq, err := sequence(value)
+	if err != nil {
+		return nil, err
+	}
+	for element := range seq {
+		return element[0], nil
+	}
+	return nil, nil
+}
+
+// filterLast returns the last element of a sequence
+func filterLast(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	elements, err := iterate(value)
+	if err != nil || len(elements) == 0 {
+		return nil, err
+	}
+	return elements[len(elements)-1][0], nil
+}
+
+// filterSort sorts a sequence, in descending order if reverse is true.
+// Strings are compared without regard to case, unless caseSensitive is true.
+// If attribute is given, elements are sorted by the value of that attribute,
+// e.g. 'users | sort(false, false, "name")'
+//  value | sort([reverse[, caseSensitive[, attribute]]])
+func filterSort(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 3); err != nil {
+		return nil, err
+	}
+	reverse := boolArg(args, 0, false)
+	caseSensitive := boolArg(args, 1, false)
+	attribute := stringArg(args, 2, "")
+
+	elements, err := iterate(value)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, len(elements))
+	keys := make([]interface{}, len(elements))
+	for k := range elements {
+		res[k] = elements[k][0]
+		keys[k] = res[k]
+		if attribute != "" {
+			keys[k], err = getAttr(res[k], attribute)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if s, ok := toString(keys[k]); ok && !caseSensitive {
+			keys[k] = strings.ToLower(s)
+		}
+	}
+
+	sort.Stable(keySorter{res, keys, reverse})
+	return res, nil
+}
+
+// keySorter sorts values according to keys
+type keySorter struct {
+	values  []interface{}
+	keys    []interface{}
+	reverse bool
+}
+
+func (s keySorter) Len() int { return len(s.values) }
+func (s keySorter) Less(i, j int) bool {
+	if s.reverse {
+		return less(s.keys[j], s.keys[i])
+	}
+	return less(s.keys[i], s.keys[j])
+}
+func (s keySorter) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// filterReverse reverses a string or a sequence
+func filterReverse(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	if s, ok := toString(value); ok {
+		runes := []rune(s)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}
+
+	elements, err := iterate(value)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(elements))
+	for k := range elements {
+		res[len(res)-k-1] = elements[k][0]
+	}
+	return res, nil
+}
+
+// filterEscape escapes a value for use in HTML
+func filterEscape(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	return escapeHTML(value), nil
+}
+
+// filterSafe marks a value as safe, so that it will not be escaped
+func filterSafe(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return nil, err
+	}
+	if m, ok := value.(Markup); ok {
+		return m, nil
+	}
+	return Markup(toText(value)), nil
+}
+
+// filterInt converts a value to an integer. If the conversion fails, def is
+// returned, which defaults to 0
+//  value | int([def])
+func filterInt(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	if i, f, isInt, ok := toNumber(value); ok {
+		if isInt {
+			return i, nil
+		}
+		return int64(f), nil
+	}
+	if s, ok := toString(value); ok {
+		s = strings.TrimSpace(s)
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int64(f), nil
+		}
+	}
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return int64(0), nil
+}
+
+// filterFloat converts a value to a floating point number. If the conversion
+// fails, def is returned, which defaults to 0.0
+//  value | float([def])
+func filterFloat(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	if _, f, _, ok := toNumber(value); ok {
+		return f, nil
+	}
+	if s, ok := toString(value); ok {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f, nil
+		}
+	}
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return float64(0), nil
+}
+
+// filterRound rounds a number to the given precision, which defaults to 0.
+// method is either "common" (round half away from zero, the default),
+// "ceil" (always round up) or "floor" (always round down)
+//  value | round([precision[, method]])
+func filterRound(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 2); err != nil {
+		return nil, err
+	}
+	precision, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, f, _, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot round %T", value)
+	}
+
+	p := math.Pow10(precision)
+	switch method := stringArg(args, 1, "common"); method {
+	case "common":
+		return math.Round(f*p) / p, nil
+	case "ceil":
+		return math.Ceil(f*p) / p, nil
+	case "floor":
+		return math.Floor(f*p) / p, nil
+	default:
+		return nil, fmt.Errorf("unknown rounding method '%s'", method)
+	}
+}
+
+// filterDate formats a time according to layout, which uses the same format as
+// the time package, and defaults to "2006-01-02". Besides time.Time, the value
+// can be an integer with the number of seconds since the unix epoch, or a
+// string in RFC 3339 format.
+//  value | date([layout])
+func filterDate(value interface{}, args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	layout := stringArg(args, 0, "2006-01-02")
+
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		t = *v
+	case nil:
+		return "", nil
+	default:
+		if i, _, isInt, ok := toNumber(value); ok && isInt {
+			t = time.Unix(i, 0)
+			break
+		}
+		s, ok := toString(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot format %T as date", value)
+		}
+		var err error
+		t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.Format(layout), nil
+}
@@ -0,0 +1,93 @@
+package xt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type filterItem struct {
+	Name string
+	N    int
+}
+
+func TestFilters(t *testing.T) {
+	data := map[string]interface{}{
+		"s":     "Hello World",
+		"items": []string{"b", "C", "a"},
+		"nums":  []int{3, 1, 2},
+		"objs":  []filterItem{{"x", 2}, {"y", 1}},
+		"t":     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		"nil":   nil,
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "upper", tmpl: "{{ s | upper }}", data: data, want: "HELLO WORLD"},
+		{name: "lower", tmpl: "{{ s | lower }}", data: data, want: "hello world"},
+		{name: "title", tmpl: "{{ 'hello wORLD-wide' | title }}", want: "Hello World-Wide"},
+		{name: "pipeline", tmpl: "{{ s | lower | replace('world', 'there') | upper }}", data: data, want: "HELLO THERE"},
+		{name: "trim", tmpl: "[{{ '  x  ' | trim }}][{{ '--x--' | trim('-') }}]", want: "[x][x]"},
+		{name: "truncate", tmpl: "{{ 'hello big world' | truncate(11) }}", want: "hello..."},
+		{name: "truncate killwords", tmpl: "{{ 'hello big world' | truncate(11, true) }}", want: "hello bi..."},
+		{name: "truncate end", tmpl: "{{ 'hello big world' | truncate(11, true, '!') }}", want: "hello big !"},
+		{name: "truncate short", tmpl: "{{ 'hello' | truncate(10) }}", want: "hello"},
+		{name: "default", tmpl: "{{ missing | default('x') }} {{ s | default('x') }}", data: data, want: "x Hello World"},
+		{name: "default boolean", tmpl: "{{ '' | default('x') }}[{{ '' | default('x', true) }}]", want: "[x]"},
+		{name: "length", tmpl: "{{ items | length }} {{ 'héj' | length }} {{ nil | length }}", data: data, want: "3 3 0"},
+		{name: "join", tmpl: "{{ items | join(', ') }} {{ nums | join }}", data: data, want: "b, C, a 312"},
+		{name: "first last", tmpl: "{{ items | first }}{{ items | last }}", data: data, want: "ba"},
+		{name: "sort", tmpl: "{{ items | sort | join }}", data: data, want: "abC"},
+		{name: "sort reverse", tmpl: "{{ nums | sort(true) | join }}", data: data, want: "321"},
+		{name: "sort case sensitive", tmpl: "{{ items | sort(false, true) | join }}", data: data, want: "Cab"},
+		{name: "sort attribute", tmpl: "{% for o in objs | sort(false, false, 'n') %}{{ o.Name }}{% endfor %}", data: data, want: "yx"},
+		{name: "reverse", tmpl: "{{ nums | reverse | join }} {{ 'abc' | reverse }}", data: data, want: "213 cba"},
+		{name: "escape", tmpl: "{{ '<a>' | escape }}", want: "&lt;a&gt;"},
+		{name: "int", tmpl: "{{ '42' | int + 1 }} {{ 3.9 | int }} {{ 'x' | int(7) }}", want: "43 3 7"},
+		{name: "float", tmpl: "{{ '1.5' | float }} {{ 'x' | float }}", want: "1.5 0"},
+		{name: "round", tmpl: "{{ 2.5 | round }} {{ 3.14159 | round(2) }} {{ 1.1 | round(0, 'ceil') }} {{ 1.9 | round(0, 'floor') }}", want: "3 3.14 2 1"},
+		{name: "date", tmpl: "{{ t | date }} {{ t | date('15:04') }}", data: data, want: "2024-03-01 12:00"},
+		{name: "date string", tmpl: "{{ '2024-03-01T12:00:00Z' | date('2006') }}", want: "2024"},
+		{name: "filter in if", tmpl: "{% if items | length > 2 %}many{% endif %}", data: data, want: "many"},
+		{name: "unknown filter", tmpl: "{{ s | nosuchfilter }}", data: data, err: "unknown filter 'nosuchfilter'"},
+		{name: "wrong argument count", tmpl: "{{ s | upper(1) }}", data: data, err: "filter 'upper': expected 0 arguments, got 1"},
+		{name: "wrong argument type", tmpl: "{{ s | truncate('a') }}", data: data, err: "argument 1 must be an integer"},
+		{name: "bad round method", tmpl: "{{ 1 | round(0, 'x') }}", err: "unknown rounding method"},
+	})
+}
+
+func TestAddFilter(t *testing.T) {
+	env := NewEnvironment()
+	env.AddFilter("repeat", func(value interface{}, args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return nil, err
+		}
+		n, err := intArg(args, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		var s string
+		for i := 0; i < n; i++ {
+			s += toText(value)
+		}
+		return s, nil
+	})
+	env.AddFilter("fail", func(value interface{}, args ...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("failed")
+	})
+	env.AddFilter("panic", func(value interface{}, args ...interface{}) (interface{}, error) {
+		return value.([]string)[0], nil
+	})
+	runExecTests(t, env, []execTest{
+		{name: "custom filter", tmpl: "{{ 'ab' | repeat(3) }}", want: "ababab"},
+		{name: "error", tmpl: "{{ 1 | fail }}", err: ":1:4: filter 'fail': failed"},
+		{name: "panic", tmpl: "{{ 1 | panic }}", err: ":1:4: filter 'panic': panic: interface conversion"},
+	})
+}
+
+func TestFilterEdgeCases(t *testing.T) {
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "truncate empty", tmpl: "[{{ '' | truncate(0) }}][{{ '' | truncate(-1) }}]", want: "[][]"},
+		{name: "truncate negative", tmpl: "{{ 'abc' | truncate(-1) }}", want: "..."},
+		{name: "truncate shorter than end", tmpl: "{{ 'abcdef' | truncate(2) }}", want: "..."},
+		{name: "keyword argument", tmpl: "{{ [1] | sort(reverse=true) }}", err: "filters and tests do not take keyword arguments"},
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package xt
 
 import (
 	"fmt"
@@ -11,12 +11,23 @@ type item struct {
 	typ  itemType // The type of this item.
 	pos  Pos      // The starting position, in bytes, of this item in the input string.
 	val  string   // The value of this item.
-	line int      // The line number at the start of this item.
-	col  int      // Column of the current item
+	line int      // The line number at the start of this item, starting at 1.
+	col  int      // The column of the start of this item in runes, starting at 1.
 }
 
+// String returns a description of the item, for use in error messages
 func (i item) String() string {
-	return fmt.Sprintf("%02d:%02d %s - %s", i.line, i.pos, i.typ, i.val)
+	switch {
+	case i.typ == itemEOF:
+		return "end of file"
+	case i.typ == itemError:
+		return i.val
+	case i.typ > itemKeyword:
+		return fmt.Sprintf("keyword '%s'", i.val)
+	case len(i.val) > 20:
+		return fmt.Sprintf("%s %.20q...", i.typ, i.val)
+	}
+	return fmt.Sprintf("%s %q", i.typ, i.val)
 }
 
 // itemType identifies the type of lex items.
@@ -36,6 +47,7 @@ const (
 	itemTagStart   // left action delimiter
 	itemLeftParen  // '(' inside action
 	itemNumber     // simple number, including imaginary
+	itemOperator   // arithmetic operator '+', '-', '*', '/', '//', '%'
 	itemPipe       // pipe symbol
 	itemTagEnd     // right action delimiter
 	itemRightParen // ')' inside action
@@ -46,12 +58,25 @@ const (
 	itemVarStart   // Start of a variable '{{'
 	itemVarEnd     // End of a variable '}}'
 	// Keywords appear after all the rest.
-	itemKeyword // used only to delimit the keywords
-	itemBlock   // block keyword
-	itemElse    // else keyword
-	itemElIf    // elif keyword
-	itemEnd     // end keyword
-	itemIf      // if keyword
+	itemKeyword    // used only to delimit the keywords
+	itemBlock      // block keyword
+	itemElse       // else keyword
+	itemElIf       // elif keyword
+	itemEnd        // end keyword
+	itemIf         // if keyword
+	itemFor        // for keyword
+	itemBreak      // break keyword
+	itemContinue   // continue keyword
+	itemExtends    // extends keyword
+	itemInclude    // include keyword
+	itemAutoescape // autoescape keyword
+	itemRaw        // raw keyword
+	itemMacro      // macro keyword
+	itemCall       // call keyword
+	itemImport     // import keyword
+	itemFrom       // from keyword
+	itemSet        // set keyword
+	itemWith       // with keyword
 )
 
 var itemTypeMap = map[itemType]string{
@@ -65,6 +90,7 @@ var itemTypeMap = map[itemType]string{
 	itemTagStart:   "left-delim",
 	itemLeftParen:  "left-paren",
 	itemNumber:     "number",
+	itemOperator:   "operator",
 	itemPipe:       "pipe",
 	itemTagEnd:     "right-delim",
 	itemRightParen: "right-paren",
@@ -72,12 +98,28 @@ var itemTypeMap = map[itemType]string{
 	itemString:     "string",
 	itemText:       "text",
 	itemVariable:   "variable",
-
-	itemBlock: "block",
-	itemElse:  "else",
-	itemElIf:  "elif",
-	itemEnd:   "end",
-	itemIf:    "if",
+	itemVarStart:   "var-start",
+	itemVarEnd:     "var-end",
+	itemField:      "field",
+
+	itemBlock:      "block",
+	itemElse:       "else",
+	itemElIf:       "elif",
+	itemEnd:        "end",
+	itemIf:         "if",
+	itemFor:        "for",
+	itemBreak:      "break",
+	itemContinue:   "continue",
+	itemExtends:    "extends",
+	itemInclude:    "include",
+	itemAutoescape: "autoescape",
+	itemRaw:        "raw",
+	itemMacro:      "macro",
+	itemCall:       "call",
+	itemImport:     "import",
+	itemFrom:       "from",
+	itemSet:        "set",
+	itemWith:       "with",
 }
 
 func (i itemType) String() string {
@@ -85,27 +127,30 @@ func (i itemType) String() string {
 
 }
 
-const (
-	delimTagStart = "{%"
-	delimTagEnd   = "%}"
-	delimVarStart = "{{"
-	delimVarEnd   = "}}"
-)
-
 const eof = -1
 
 type lexer struct {
 	name       string
-	line       int
-	startLine  int
-	col        int
 	input      string
 	parenDepth int
+	braceDepth int
+	insideVar  bool // true if inside a variable, false if inside a tag
+	lexOptions
+
+	trimNext    bool     // strip the whitespace at the start of the next text
+	trimNewline bool     // remove a single newline at the start of the next text
+	raw         bool     // the current tag is a raw tag, so the text after it is not tokenized
+	lineStmt    bool     // the current tag is a line statement, which ends at the end of the line
+	prev        itemType // type of the last emitted item
 
 	pos   Pos       // current position in the input
 	start Pos       // start position of this item
 	width Pos       // width of last rune read from input
 	items chan item // channel of scanned items
+
+	line      int // line of the position lastPos
+	lineStart Pos // position of the start of the line containing lastPos
+	lastPos   Pos // position of the start of the last emitted item
 }
 
 type stateFn func(*lexer) stateFn
@@ -119,9 +164,6 @@ func (l *lexer) next() rune {
 	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
 	l.width = Pos(w)
 	l.pos += l.width
-	if r == '\n' {
-		l.line++
-	}
 	return r
 }
 
@@ -135,30 +177,37 @@ func (l *lexer) peek() rune {
 // backup steps back one rune. Can only be called once per call of next.
 func (l *lexer) backup() {
 	l.pos -= l.width
-	// Correct newline count.
-	if l.width == 1 && l.input[l.pos] == '\n' {
-		l.line--
-	}
 }
 
 // emit passes an item back to the client.
 func (l *lexer) emit(t itemType) {
+	l.prev = t
+	line, col := l.position()
 	l.items <- item{
 		typ:  t,
-		pos:  l.pos,
+		pos:  l.start,
 		val:  l.input[l.start:l.pos],
-		line: l.startLine,
-		col:  l.col,
+		line: line,
+		col:  col,
 	}
 	l.start = l.pos
-	l.startLine = l.line
+}
+
+// position returns the line and column of the start of the current item.
+// Items are emitted in order, so only the input since the last item is scanned.
+func (l *lexer) position() (line, col int) {
+	text := l.input[l.lastPos:l.start]
+	if n := strings.Count(text, "\n"); n > 0 {
+		l.line += n
+		l.lineStart = l.lastPos + Pos(strings.LastIndexByte(text, '\n')) + 1
+	}
+	l.lastPos = l.start
+	return l.line, 1 + utf8.RuneCountInString(l.input[l.lineStart:l.start])
 }
 
 // ignore skips over the pending input before this point.
 func (l *lexer) ignore() {
-	l.line += strings.Count(l.input[l.start:l.pos], "\n")
 	l.start = l.pos
-	l.startLine = l.line
 }
 
 // accept consumes the next rune if it's from the valid set.
@@ -179,36 +228,94 @@ func (l *lexer) acceptRun(valid string) {
 
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
+// If the lexer is recovering from errors, the scan continues with lexRecover.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
+	line, col := l.position()
 	l.items <- item{
 		typ:  itemError,
 		pos:  l.start,
 		val:  fmt.Sprintf(format, args...),
-		line: l.startLine,
-		col:  l.col,
+		line: line,
+		col:  col,
+	}
+	if l.recover {
+		return lexRecover
 	}
 	return nil
 }
 
+// lexRecover skips the rest of the tag or variable where an error was found,
+// and emits its end delimiter, so that scanning can continue after the error.
+// If the end delimiter is not found on the same line, before the next
+// tag or variable, scanning continues with the text at the current position.
+func lexRecover(l *lexer) stateFn {
+	l.parenDepth, l.braceDepth = 0, 0
+	l.raw = false
+	if l.lineStmt {
+		if x := strings.IndexAny(l.input[l.pos:], "\r\n"); x >= 0 {
+			l.pos += Pos(x)
+		} else {
+			l.pos = Pos(len(l.input))
+		}
+		l.ignore()
+		return lexLineStatementEnd
+	}
+
+	end, typ := l.delims.TagEnd, itemTagEnd
+	if l.insideVar {
+		end, typ = l.delims.VarEnd, itemVarEnd
+	}
+	rest := l.input[l.pos:]
+	x := strings.Index(rest, end)
+	for _, delim := range []string{"\n", l.delims.TagStart, l.delims.VarStart, l.delims.CommentStart} {
+		if i := strings.Index(rest, delim); delim != "" && i >= 0 && i < x {
+			x = -1
+		}
+	}
+	if x >= 0 {
+		l.pos += Pos(x)
+		l.ignore()
+		l.pos += Pos(len(end))
+		l.emit(typ)
+	} else {
+		l.ignore()
+	}
+	return lexText
+}
+
+// lexOptions configures the syntax recognized by the lexer
+type lexOptions struct {
+	delims       Delimiters
+	trimBlocks   bool // remove the first newline after a tag
+	lstripBlocks bool // strip spaces and tabs from the start of a line up to a tag
+	recover      bool // continue scanning after errors, instead of stopping at the first error
+}
+
+const (
+	trimMarker = '-' // marker after a start delimiter or before an end delimiter, which strips whitespace
+	keepMarker = '+' // marker which disables trimBlocks or lstripBlocks for a tag
+)
+
 // lex creates a new scanner for the input string.
-func lex(name, input string) *lexer {
-	//if left == "" {
-	//	left = delimTagStart
-	//}
-	//if right == "" {
-	//	right = delimTagEnd
-	//}
+func lex(name, input string, opts lexOptions) *lexer {
 	l := &lexer{
-		name:      name,
-		input:     input,
-		items:     make(chan item),
-		line:      1,
-		startLine: 1,
+		name:       name,
+		input:      input,
+		lexOptions: opts,
+		items:      make(chan item),
+		line:       1,
 	}
 	go l.run()
 	return l
 }
 
+// drain reads the remaining items, so that the lexer goroutine exits when
+// the parser stops before the end of the input, e.g. at a syntax error.
+func (l *lexer) drain() {
+	for range l.items {
+	}
+}
+
 // run runs the state machine for the lexer.
 func (l *lexer) run() {
 	for state := lexText; state != nil; {
@@ -217,80 +324,330 @@ func (l *lexer) run() {
 	close(l.items)
 }
 
-// lexText scans until an opening action delimiter, "{%".
+// lexText scans until an opening tag, variable or comment delimiter, e.g. "{%", "{{" or "{#",
+// or until a line statement or a line comment.
 func lexText(l *lexer) stateFn {
 	l.width = 0
 
-	//if x := strings.Index(l.input[l.pos:], l.delimTagStart); x >= 0 {
-	if x := strings.IndexRune(l.input[l.pos:], '{'); x >= 0 {
-		var nextFunc stateFn
-		l.pos += Pos(x)
-
-		if strings.HasPrefix(l.input[l.pos:], delimTagStart) {
-			nextFunc = lexTagStart
-		} else if strings.HasPrefix(l.input[l.pos:], delimVarStart) {
-			nextFunc = lexVarStart
-		} else {
-			return l.errorf("unexpected sequence %s, expected {%% or {{", l.input[l.pos:l.pos+1])
+	// find the first delimiter, preferring the longest delimiter if several start at the same position
+	start, delim, nextFunc := Pos(-1), "", stateFn(nil)
+	for _, d := range []struct {
+		delim string
+		state stateFn
+	}{
+		{l.delims.TagStart, lexTagStart},
+		{l.delims.VarStart, lexVarStart},
+		{l.delims.CommentStart, lexComment},
+	} {
+		if d.delim == "" {
+			continue
 		}
+		if i := strings.Index(l.input[l.pos:], d.delim); i >= 0 && (start < 0 || l.pos+Pos(i) < start ||
+			l.pos+Pos(i) == start && len(d.delim) > len(delim)) {
+			start, delim, nextFunc = l.pos+Pos(i), d.delim, d.state
+		}
+	}
 
-		if l.pos > l.start {
-			l.line += strings.Count(l.input[l.start:l.pos], "\n")
-			l.emit(itemText)
+	// line statements and line comments also remove the whitespace preceding them
+	textEnd, isLine := start, false
+	for _, d := range []struct {
+		prefix    string
+		lineStart bool
+		state     stateFn
+	}{
+		{l.delims.LineStatement, true, lexLineStatement},
+		{l.delims.LineComment, false, lexLineComment},
+	} {
+		if d.prefix == "" {
+			continue
 		}
+		if end, i := l.indexLinePrefix(d.prefix, d.lineStart); i >= 0 && (start < 0 || i < start ||
+			i == start && len(d.prefix) > len(delim)) {
+			textEnd, start, delim, nextFunc, isLine = end, i, d.prefix, d.state, true
+		}
+	}
+
+	switch {
+	case start < 0:
+		// Correctly reached EOF.
+		l.emitText(Pos(len(l.input)), false, "")
+		l.emit(itemEOF)
+		return nil
+	case isLine:
+		l.emitText(textEnd, false, "")
+		l.pos = start
 		l.ignore()
-		return nextFunc
+	default:
+		l.emitText(start, delim != l.delims.VarStart, delim)
+	}
+	return nextFunc
+}
 
+// indexLinePrefix returns the position of the next occurrence of prefix at or after
+// the current position, and the position where the whitespace preceding it starts.
+// If lineStart is set, only the occurrences preceded by nothing but whitespace
+// on the line are considered. It returns -1 if there is no such occurrence.
+func (l *lexer) indexLinePrefix(prefix string, lineStart bool) (textEnd, start Pos) {
+	for i := l.pos; ; {
+		x := strings.Index(l.input[i:], prefix)
+		if x < 0 {
+			return -1, -1
+		}
+		start = i + Pos(x)
+		textEnd = start
+		for textEnd > l.pos && isSpace(rune(l.input[textEnd-1])) {
+			textEnd--
+		}
+		if !lineStart || l.atLineStart(start) {
+			return textEnd, start
+		}
+		i = start + Pos(len(prefix))
+	}
+}
+
+// atLineStart reports whether there is nothing but spaces between the start
+// of the line and the position pos
+func (l *lexer) atLineStart(pos Pos) bool {
+	for pos > 0 && isSpace(rune(l.input[pos-1])) {
+		pos--
+	}
+	return pos == 0 || l.input[pos-1] == '\n'
+}
+
+// emitText emits the text up to end, where the next delimiter starts, after removing
+// the whitespace selected by trim markers and the trimBlocks and lstripBlocks options.
+// isTag reports whether the text is followed by a tag or a comment, which starts with delim.
+func (l *lexer) emitText(end Pos, isTag bool, delim string) {
+	start := l.pos
+	if l.trimNext {
+		for start < end && isWhitespace(rune(l.input[start])) {
+			start++
+		}
+	} else if l.trimNewline {
+		if strings.HasPrefix(l.input[start:end], "\r\n") {
+			start += 2
+		} else if strings.HasPrefix(l.input[start:end], "\n") {
+			start++
+		}
+	}
+	l.trimNext, l.trimNewline = false, false
+
+	textEnd := end
+	if next := l.input[end:]; delim != "" && len(next) > len(delim) {
+		marker := next[len(delim)]
+		switch {
+		case strings.HasPrefix(next, delim) && marker == trimMarker:
+			for textEnd > start && isWhitespace(rune(l.input[textEnd-1])) {
+				textEnd--
+			}
+		case isTag && l.lstripBlocks && marker != keepMarker:
+			// only strip the whitespace if the tag is the first thing on the line
+			i := textEnd
+			for i > 0 && isSpace(rune(l.input[i-1])) {
+				i--
+			}
+			if (i == 0 || l.input[i-1] == '\n') && i >= start {
+				textEnd = i
+			}
+		}
 	}
-	l.pos = Pos(len(l.input))
-	// Correctly reached EOF.
-	if l.pos > l.start {
-		l.line += strings.Count(l.input[l.start:l.pos], "\n")
+
+	l.pos = start
+	l.ignore()
+	if textEnd > start {
+		l.pos = textEnd
 		l.emit(itemText)
 	}
-	l.emit(itemEOF)
-	return nil
+	l.pos = end
+	l.ignore()
+}
+
+// lexComment skips a comment '{# ... #}', which may span multiple lines.
+// Trim markers are handled as for tags, e.g. '{#- ... -#}'.
+func lexComment(l *lexer) stateFn {
+	l.pos += Pos(len(l.delims.CommentStart))
+	l.accept(string(trimMarker) + string(keepMarker))
+	x := strings.Index(l.input[l.pos:], l.delims.CommentEnd)
+	if x < 0 {
+		l.pos = Pos(len(l.input))
+		return l.errorf("unclosed comment")
+	}
+	l.pos += Pos(x)
+	switch {
+	case x > 0 && l.input[l.pos-1] == trimMarker:
+		l.trimNext = true
+	case x > 0 && l.input[l.pos-1] == keepMarker:
+	default:
+		l.trimNewline = l.trimBlocks
+	}
+	l.pos += Pos(len(l.delims.CommentEnd))
+	l.ignore()
+	return lexText
+}
+
+// lexLineStatement scans the prefix of a line statement, e.g. '# for x in y'.
+// A line statement is equivalent to a tag, which ends at the end of the line.
+func lexLineStatement(l *lexer) stateFn {
+	l.pos += Pos(len(l.delims.LineStatement))
+	l.insideVar = false
+	l.lineStmt = true
+	l.emit(itemTagStart)
+	return lexInsideTag
+}
+
+// lexLineStatementEnd scans the end of a line statement, including
+// an optional ':' and the newline
+func lexLineStatementEnd(l *lexer) stateFn {
+	l.accept(":")
+	for isSpace(l.peek()) {
+		l.next()
+	}
+	if !l.accept("\r") || l.peek() == '\n' {
+		l.accept("\n")
+	}
+	l.lineStmt = false
+	l.emit(itemTagEnd)
+	if l.raw {
+		l.raw = false
+		return lexRaw
+	}
+	return lexText
+}
+
+// lexLineComment skips a line comment, e.g. '## comment', up to the end of the line.
+// The newline is kept.
+func lexLineComment(l *lexer) stateFn {
+	if x := strings.IndexAny(l.input[l.pos:], "\r\n"); x >= 0 {
+		l.pos += Pos(x)
+	} else {
+		l.pos = Pos(len(l.input))
+	}
+	l.ignore()
+	return lexText
 }
 
-// lexTagStart scans the start tag marker '{%'
+// lexTagStart scans the start tag marker '{%', with an optional trim marker '{%-'
+// or a marker disabling lstripBlocks '{%+'
 func lexTagStart(l *lexer) stateFn {
-	l.pos += Pos(len(delimTagStart))
+	l.pos += Pos(len(l.delims.TagStart))
+	l.accept(string(trimMarker) + string(keepMarker))
+	l.insideVar = false
 	l.emit(itemTagStart)
 	return lexInsideTag
 }
 
-// lexTagEnd scans the end tag marker '%}'
+// lexTagEnd scans the end tag marker '%}', with an optional trim marker '-%}'
+// or a marker disabling trimBlocks '+%}'
 func lexTagEnd(l *lexer) stateFn {
-	l.pos += Pos(len(delimTagEnd))
+	switch {
+	case strings.HasPrefix(l.input[l.pos:], l.delims.TagEnd):
+		l.trimNewline = l.trimBlocks
+	case l.input[l.pos] == trimMarker:
+		l.trimNext = true
+		l.pos++
+	default:
+		l.pos++ // keepMarker
+	}
+	l.pos += Pos(len(l.delims.TagEnd))
 	l.emit(itemTagEnd)
+	if l.raw {
+		l.raw = false
+		return lexRaw
+	}
 	return lexText
 }
 
-// lexVarStart is the start of a variable '{{'
+// lexRaw scans the text after a raw tag, up to the next endraw tag,
+// and emits it as a single text item without tokenizing it
+func lexRaw(l *lexer) stateFn {
+	x := l.indexEndRaw()
+	if x < 0 {
+		l.pos = Pos(len(l.input))
+		return l.errorf("unclosed raw tag, expected 'endraw'-tag")
+	}
+	l.emitText(l.pos+Pos(x), true, l.delims.TagStart)
+	return lexTagStart
+}
+
+// indexEndRaw returns the index of the next endraw tag, relative to the
+// current position, or -1 if there is no endraw tag
+func (l *lexer) indexEndRaw() int {
+	input := l.input[l.pos:]
+	for i := 0; ; {
+		x := strings.Index(input[i:], l.delims.TagStart)
+		if x < 0 {
+			return -1
+		}
+		i += x
+		rest := input[i+len(l.delims.TagStart):]
+		rest = strings.TrimPrefix(rest, string(trimMarker))
+		rest = strings.TrimPrefix(rest, string(keepMarker))
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "endraw") {
+			rest = strings.TrimLeft(rest[len("endraw"):], " \t")
+			rest = strings.TrimPrefix(rest, string(trimMarker))
+			rest = strings.TrimPrefix(rest, string(keepMarker))
+			if strings.HasPrefix(rest, l.delims.TagEnd) {
+				return i
+			}
+		}
+		i += len(l.delims.TagStart)
+	}
+}
+
+// lexVarStart is the start of a variable '{{', with an optional trim marker '{{-'
 func lexVarStart(l *lexer) stateFn {
-	l.pos += Pos(len(delimVarStart))
+	l.pos += Pos(len(l.delims.VarStart))
+	l.accept(string(trimMarker))
+	l.insideVar = true
 	l.emit(itemVarStart)
 	return lexInsideTag
 }
 
-// lexVarEnd is the start of a variable '}}'
+// lexVarEnd is the start of a variable '}}', with an optional trim marker '-}}'
 func lexVarEnd(l *lexer) stateFn {
-	l.pos += Pos(len(delimVarEnd))
+	if !strings.HasPrefix(l.input[l.pos:], l.delims.VarEnd) {
+		l.trimNext = true
+		l.pos++
+	}
+	l.pos += Pos(len(l.delims.VarEnd))
 	l.emit(itemVarEnd)
 	return lexText
 }
 
+// atLineStatementEnd reports whether the input at the current position is the
+// end of a line statement, i.e. the end of the line, optionally preceded by ':'
+func (l *lexer) atLineStatementEnd() bool {
+	rest := strings.TrimLeft(strings.TrimPrefix(l.input[l.pos:], ":"), " \t")
+	return rest == "" || isEndOfLine(rune(rest[0]))
+}
+
+// atTagEnd reports whether the input at the current position is the end
+// delimiter delim, optionally preceded by one of the markers
+func (l *lexer) atTagEnd(delim, markers string) bool {
+	rest := l.input[l.pos:]
+	if len(rest) > 0 && strings.IndexByte(markers, rest[0]) >= 0 && strings.HasPrefix(rest[1:], delim) {
+		return true
+	}
+	return strings.HasPrefix(rest, delim)
+}
+
 // lexInsideTag scans the elements inside action delimiters.
 func lexInsideTag(l *lexer) stateFn {
 	// Either number, quoted string, or identifier.
 	// Spaces separate arguments; runs of spaces turn into itemSpace.
 	// Pipe symbols separate and are emitted.
-	if strings.HasPrefix(l.input[l.pos:], delimTagEnd) { // Without trim marker.
+	if l.lineStmt && l.atLineStatementEnd() {
+		if l.parenDepth > 0 {
+			return l.errorf("missing right paren")
+		}
+		return lexLineStatementEnd
+	} else if !l.insideVar && !l.lineStmt && l.atTagEnd(l.delims.TagEnd, string(trimMarker)+string(keepMarker)) {
 		if l.parenDepth > 0 {
 			return l.errorf("missing right paren")
 		}
 		return lexTagEnd
-	} else if strings.HasPrefix(l.input[l.pos:], delimVarEnd) { // Without trim marker.
+	} else if l.insideVar && l.braceDepth == 0 && l.atTagEnd(l.delims.VarEnd, string(trimMarker)) {
 		if l.parenDepth > 0 {
 			return l.errorf("missing right paren")
 		}
@@ -328,12 +685,20 @@ func lexInsideTag(l *lexer) stateFn {
 		return lexQuote
 	case r == '\'':
 		return lexSingleQuote
-	case r == '+' || r == '-' || ('0' <= r && r <= '9'):
+	case r == '+' || r == '-' || r == '*' || r == '%':
+		l.emit(itemOperator)
+	case r == '/':
+		l.accept("/")
+		l.emit(itemOperator)
+	case '0' <= r && r <= '9':
 		l.backup()
 		return lexNumber
 	case isAlphaNumeric(r):
 		l.backup()
 		return lexIdentifier
+	case r == '.' && isAlphaNumeric(l.peek()):
+		// field access, e.g. '.name' in 'user.name'
+		return lexIdentifier
 	case r == '(':
 		l.emit(itemLeftParen)
 		l.parenDepth++
@@ -343,6 +708,16 @@ func lexInsideTag(l *lexer) stateFn {
 		if l.parenDepth < 0 {
 			return l.errorf("unexpected right paren %#U", r)
 		}
+	case r == '{':
+		// dict literal
+		l.emit(itemChar)
+		l.braceDepth++
+	case r == '}':
+		l.emit(itemChar)
+		l.braceDepth--
+		if l.braceDepth < 0 {
+			return l.errorf("unexpected right brace %#U", r)
+		}
 	case r <= unicode.MaxASCII && unicode.IsPrint(r):
 		l.emit(itemChar)
 		return lexInsideTag
@@ -426,35 +801,48 @@ Loop:
 }
 
 var typeMap = map[string]itemType{
-	"block": itemBlock,
-	"if":    itemIf,
-	"else":  itemElse,
-	"elif":  itemElIf,
+	"block":      itemBlock,
+	"if":         itemIf,
+	"else":       itemElse,
+	"elif":       itemElIf,
+	"for":        itemFor,
+	"break":      itemBreak,
+	"continue":   itemContinue,
+	"extends":    itemExtends,
+	"include":    itemInclude,
+	"autoescape": itemAutoescape,
+	"raw":        itemRaw,
+	"macro":      itemMacro,
+	"call":       itemCall,
+	"import":     itemImport,
+	"from":       itemFrom,
+	"set":        itemSet,
+	"with":       itemWith,
 }
 
+// lexIdentifier lexes an alphanumeric word, which is either a keyword,
+// a boolean constant or an identifier. Words are keywords only as the name
+// of a tag, so that e.g. 'set' can still be used as a variable.
 func lexIdentifier(l *lexer) stateFn {
-Loop:
-	for {
-		switch r := l.next(); {
-		case isSpace(r):
-			l.backup()
-			word := l.input[l.start:l.pos]
-			switch {
-			case typeMap[word] > itemKeyword:
-				l.emit(typeMap[word])
-			case word[0] == '.':
-				l.emit(itemField)
-			case word == "true", word == "false":
-				l.emit(itemBool)
-			default:
-				l.emit(itemIdentifier)
-			}
-			break Loop
-		case isAlphaNumeric(r):
-			// absorb.
-		default:
-			return l.errorf("bad character %#U", r)
-		}
+	for isAlphaNumeric(l.next()) {
+		// absorb.
+	}
+	l.backup()
+
+	word := l.input[l.start:l.pos]
+	tagName := !l.insideVar && l.prev == itemTagStart
+	switch {
+	case typeMap[word] == itemRaw && tagName:
+		l.raw = true
+		l.emit(itemRaw)
+	case typeMap[word] > itemKeyword && tagName:
+		l.emit(typeMap[word])
+	case word[0] == '.':
+		l.emit(itemField)
+	case word == "true", word == "false":
+		l.emit(itemBool)
+	default:
+		l.emit(itemIdentifier)
 	}
 	return lexInsideTag
 }
@@ -464,6 +852,11 @@ func isSpace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
 
+// isWhitespace reports whether r is a space or an end-of-line character
+func isWhitespace(r rune) bool {
+	return isSpace(r) || isEndOfLine(r)
+}
+
 // isEndOfLine reports whether r is an end-of-line character.
 func isEndOfLine(r rune) bool {
 	return r == '\r' || r == '\n'
@@ -0,0 +1,173 @@
+package xt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhitespaceControl(t *testing.T) {
+	data := map[string]int{"x": 1}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "no markers", tmpl: "a \n {% if true %} b {% endif %} \nc", want: "a \n  b  \nc"},
+		{name: "trim before tag", tmpl: "a \n {%- if true %}b{% endif %}", want: "ab"},
+		{name: "trim after tag", tmpl: "{% if true -%} \n b{% endif %}", want: "b"},
+		{name: "trim both", tmpl: "a  {%- if true -%}  b  {%- endif -%}  c", want: "abc"},
+		{name: "trim variable", tmpl: "a \n {{- x -}} \n b", data: data, want: "a1b"},
+		{name: "trim comment", tmpl: "a \n {#- c -#} \n b", want: "ab"},
+		{name: "trim in loop", tmpl: "{% for i in [1, 2, 3] -%}\n  {{ i }}\n{%- endfor %}", want: "123"},
+		{name: "trim only whitespace", tmpl: "a.{%- if true -%}.b{% endif %}", want: "a..b"},
+		{name: "minus expression", tmpl: "{{ 3 -1 }}{{ -x }}", data: data, want: "2-1"},
+		{name: "keep markers", tmpl: "a \n{%+ if true +%}\nb{% endif %}", want: "a \n\nb"},
+	})
+
+	env := NewEnvironment()
+	env.SetTrimBlocks(true)
+	runExecTests(t, env, []execTest{
+		{name: "trim blocks", tmpl: "{% if true %}\na\n{% endif %}\nb", want: "a\nb"},
+		{name: "trim blocks only first newline", tmpl: "{% if true %}\n\na{% endif %}", want: "\na"},
+		{name: "trim blocks not variables", tmpl: "{{ x }}\na", data: data, want: "1\na"},
+		{name: "trim blocks comment", tmpl: "{# c #}\na", want: "a"},
+		{name: "trim blocks crlf", tmpl: "{% if true %}\r\na{% endif %}", want: "a"},
+		{name: "trim blocks disabled", tmpl: "{% if true +%}\na{% endif %}", want: "\na"},
+		{name: "trim blocks spaces", tmpl: "{% if true %}  \na{% endif %}", want: "  \na"},
+	})
+
+	env = NewEnvironment()
+	env.SetLstripBlocks(true)
+	runExecTests(t, env, []execTest{
+		{name: "lstrip blocks", tmpl: "a\n  \t{% if true %}b{% endif %}", want: "a\nb"},
+		{name: "lstrip blocks first line", tmpl: "  {% if true %}b{% endif %}", want: "b"},
+		{name: "lstrip blocks after text", tmpl: "a {% if true %}b{% endif %}", want: "a b"},
+		{name: "lstrip blocks not variables", tmpl: "  {{ x }}", data: data, want: "  1"},
+		{name: "lstrip blocks comment", tmpl: "a\n  {# c #}b", want: "a\nb"},
+		{name: "lstrip blocks disabled", tmpl: "  {%+ if true %}b{% endif %}", want: "  b"},
+	})
+
+	env = NewEnvironment()
+	env.SetTrimBlocks(true)
+	env.SetLstripBlocks(true)
+	runExecTests(t, env, []execTest{
+		{name: "trim and lstrip", tmpl: "<ul>\n  {% for i in [1, 2] %}\n  <li>{{ i }}</li>\n  {% endfor %}\n</ul>", want: "<ul>\n  <li>1</li>\n  <li>2</li>\n</ul>"},
+	})
+}
+
+func TestComments(t *testing.T) {
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "comment", tmpl: "a{# comment #}b", want: "ab"},
+		{name: "multi-line", tmpl: "a{# line 1\nline 2 #}b", want: "ab"},
+		{name: "tags in comment", tmpl: "a{# {% if %} {{ x }} #}b", want: "ab"},
+		{name: "not nested", tmpl: "{# a {# b #}c #}", want: "c #}"},
+		{name: "empty", tmpl: "a{##}b", want: "ab"},
+		{name: "in loop", tmpl: "{% for i in [1, 2] %}{# {{ i }} #}{{ i }}{% endfor %}", want: "12"},
+		{name: "line after comment", tmpl: "{# a\nb #}{{ 1 / 0 }}", err: "line after comment:2:"},
+		{name: "unterminated", tmpl: "a{# comment", err: "unterminated:1:2: unclosed comment"},
+	})
+}
+
+func TestDelimiters(t *testing.T) {
+	env := NewEnvironment()
+	err := env.SetDelimiters(Delimiters{
+		TagStart: "<%", TagEnd: "%>",
+		VarStart: "${", VarEnd: "}",
+		CommentStart: "<#", CommentEnd: "#>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]int{"x": 1}
+	runExecTests(t, env, []execTest{
+		{name: "tags", tmpl: "<% if x %>${ x }<% endif %><# c #>", data: data, want: "1"},
+		{name: "default delimiters", tmpl: "{% if x %}{{ x }}{# c #}", data: data, want: "{% if x %}{{ x }}{# c #}"},
+		{name: "dict", tmpl: "${ {'a': 1}['a'] }", want: "1"},
+		{name: "trim markers", tmpl: "a <%- if x -%> b <%- endif %>", data: data, want: "ab"},
+		{name: "raw", tmpl: "<% raw %>${ x }<% endraw %>", want: "${ x }"},
+		{name: "error", tmpl: "<% if %>", err: "error:1:7:"},
+	})
+
+	// longer delimiters are preferred when several start at the same position
+	env = NewEnvironment()
+	err = env.SetDelimiters(Delimiters{TagStart: "<%", TagEnd: "%>", VarStart: "<%=", VarEnd: "%>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runExecTests(t, env, []execTest{
+		{name: "prefix delimiters", tmpl: "<% if x %><%= x %><% endif %>{# c #}", data: data, want: "1{# c #}"},
+	})
+
+	env = NewEnvironment()
+	err = env.SetDelimiters(Delimiters{
+		TagStart: "{%", TagEnd: "%}", VarStart: "{{", VarEnd: "}}",
+		LineStatement: "#", LineComment: "##",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runExecTests(t, env, []execTest{
+		{name: "line statements", tmpl: "# for i in [1, 2]\n{{ i }}\n# endfor\n", want: "1\n2\n"},
+		{name: "line statement colon", tmpl: "  # if true:\nyes\n# endif", want: "yes\n"},
+		{name: "line comment", tmpl: "a ## comment\nb", want: "a\nb"},
+		{name: "prefix in text", tmpl: "a # b", want: "a # b"},
+		{name: "comments disabled", tmpl: "{# c #}", want: "{# c #}"},
+	})
+}
+
+func TestTreeDelimiters(t *testing.T) {
+	env := newTestEnv(map[string]string{"part": "{{ x }}"})
+	tree := env.NewTree("custom")
+	if err := tree.SetDelimiters(Delimiters{TagStart: "[%", TagEnd: "%]", VarStart: "[[", VarEnd: "]]"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Parse("[[ x ]]{{ x }}[% include 'part' %]"); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := tree.Execute(&sb, map[string]int{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	// the included template uses the delimiters of the environment
+	if want := "1{{ x }}1"; sb.String() != want {
+		t.Fatalf("expected %q, got %q", want, sb.String())
+	}
+}
+
+func TestInvalidDelimiters(t *testing.T) {
+	tests := []struct {
+		name   string
+		delims Delimiters
+		err    string
+	}{
+		{"empty", Delimiters{TagStart: "{%", TagEnd: "%}", VarStart: "{{"}, "delimiters cannot be empty"},
+		{"comment start only", Delimiters{TagStart: "{%", TagEnd: "%}", VarStart: "{{", VarEnd: "}}", CommentStart: "{#"}, "comment delimiters must both be set"},
+		{"same start", Delimiters{TagStart: "{", TagEnd: "}", VarStart: "{", VarEnd: "}"}, "start delimiters must differ"},
+		{"same line prefix", Delimiters{TagStart: "{%", TagEnd: "%}", VarStart: "{{", VarEnd: "}}", LineStatement: "#", LineComment: "#"}, "prefixes must differ"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := NewEnvironment().SetDelimiters(test.delims); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+			if err := NewTree("t").SetDelimiters(test.delims); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q from the tree, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestKeywordsAsNames(t *testing.T) {
+	env := newTestEnv(map[string]string{"macros": "{% macro with(set) %}{{ set }}{% endmacro %}{% set from = 3 %}"})
+	env.AddFunction("f", func(kw Kwargs) interface{} { return kw["import"] })
+	data := map[string]int{"set": 1, "with": 2, "from": 3, "import": 4, "for": 5, "macro": 6, "raw": 7, "include": 8}
+	runExecTests(t, env, []execTest{
+		{name: "variables", tmpl: "{{ set }}{{ with }}{{ from }}{{ import }}{{ for }}{{ macro }}{{ raw }}{{ include }}", data: data, want: "12345678"},
+		{name: "in expressions", tmpl: "{{ set + with }} {{ [from, import] }}", data: data, want: "3 [3 4]"},
+		{name: "in tags", tmpl: "{% if set %}{{ with }}{% endif %}", data: data, want: "2"},
+		{name: "trim marker", tmpl: "{%- set with = 1 -%}{{- with -}}", want: "1"},
+		{name: "set", tmpl: "{% set import = 1 %}{% set set, for = [2, 3] %}{{ import }}{{ set }}{{ for }}", want: "123"},
+		{name: "loop variable", tmpl: "{% for from in [1, 2] %}{{ from }}{% endfor %}", want: "12"},
+		{name: "with", tmpl: "{% with set = 1 %}{{ set }}{% endwith %}", want: "1"},
+		{name: "macro arguments", tmpl: "{% macro m(set, with=2) %}{{ set }}{{ with }}{% endmacro %}{{ m(1) }}{{ m(with=4, set=3) }}", want: "1234"},
+		{name: "keyword arguments", tmpl: "{{ f(import=1) }}", want: "1"},
+		{name: "import", tmpl: "{% import 'macros' as import %}{{ import.with(1) }}{{ import.from }}", want: "13"},
+		{name: "from import", tmpl: "{% from 'macros' import with as set, from as with %}{{ set(1) }}{{ with }}", want: "13"},
+	})
+}
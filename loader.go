@@ -0,0 +1,121 @@
+package xt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrTemplateNotFound is returned, possibly wrapped, by loaders when a template does not exist
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Loader loads the source of templates by name
+type Loader interface {
+	// Load returns the source of the template called name.
+	// If the template does not exist, an error wrapping ErrTemplateNotFound is returned
+	Load(name string) (string, error)
+}
+
+// MapLoader loads templates from a map of template names to template sources
+type MapLoader map[string]string
+
+// Load returns the source of the template called name
+func (m MapLoader) Load(name string) (string, error) {
+	src, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	}
+	return src, nil
+}
+
+// FSLoader loads templates from a file system, e.g. an embed.FS.
+// Template names are slash-separated paths relative to the root of the file system.
+type FSLoader struct {
+	FS fs.FS
+}
+
+// Load returns the source of the template called name
+func (l FSLoader) Load(name string) (string, error) {
+	p := path.Clean(name)
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("%s: invalid template name", name)
+	}
+
+	src, err := fs.ReadFile(l.FS, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	} else if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
+
+// FileSystemLoader loads templates from a list of directories, which are
+// searched in order. Template names are slash-separated paths relative to
+// the directories, and names referring to files outside the directories,
+// like "../secret.txt", are rejected.
+type FileSystemLoader struct {
+	Dirs []string
+}
+
+// NewFileSystemLoader creates a loader searching for templates in dirs
+func NewFileSystemLoader(dirs ...string) *FileSystemLoader {
+	return &FileSystemLoader{Dirs: dirs}
+}
+
+// Load returns the source of the template called name
+func (l *FileSystemLoader) Load(name string) (string, error) {
+	for _, dir := range l.Dirs {
+		src, err := FSLoader{FS: os.DirFS(dir)}.Load(name)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		return src, err
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+}
+
+// ChainLoader tries each loader in turn, and returns the template
+// from the first loader containing it
+type ChainLoader []Loader
+
+// Load returns the source of the template called name
+func (c ChainLoader) Load(name string) (string, error) {
+	for _, l := range c {
+		src, err := l.Load(name)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		return src, err
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+}
+
+// PrefixLoader selects a loader based on a prefix of the template name.
+// With the default delimiter, "admin:index.html" loads the template
+// "index.html" from the loader with the prefix "admin".
+type PrefixLoader struct {
+	Loaders   map[string]Loader
+	Delimiter string // separates the prefix from the name, defaults to ":"
+}
+
+// Load returns the source of the template called name
+func (p *PrefixLoader) Load(name string) (string, error) {
+	delim := p.Delimiter
+	if delim == "" {
+		delim = ":"
+	}
+
+	prefix, rest, ok := strings.Cut(name, delim)
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	}
+	l, ok := p.Loaders[prefix]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrTemplateNotFound)
+	}
+	return l.Load(rest)
+}
@@ -0,0 +1,142 @@
+package xt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// loaderTest is a template name, together with the expected source, or
+// the expected error if notFound or invalid is set
+type loaderTest struct {
+	name     string
+	want     string
+	notFound bool
+	invalid  bool
+}
+
+// testLoader loads each of tests from l, and compares the result
+func testLoader(t *testing.T, l Loader, tests []loaderTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src, err := l.Load(test.name)
+			switch {
+			case test.notFound && !errors.Is(err, ErrTemplateNotFound):
+				t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+			case test.invalid && (err == nil || errors.Is(err, ErrTemplateNotFound)):
+				t.Fatalf("expected invalid name error, got %v", err)
+			case !test.notFound && !test.invalid && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case src != test.want:
+				t.Fatalf("expected %q, got %q", test.want, src)
+			}
+		})
+	}
+}
+
+func TestMapLoader(t *testing.T) {
+	testLoader(t, MapLoader{"a.html": "a", "dir/b.html": "b"}, []loaderTest{
+		{name: "a.html", want: "a"},
+		{name: "dir/b.html", want: "b"},
+		{name: "missing.html", notFound: true},
+		{name: "b.html", notFound: true},
+	})
+}
+
+func TestFSLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.html":     {Data: []byte("a")},
+		"dir/b.html": {Data: []byte("b")},
+	}
+	testLoader(t, FSLoader{FS: fsys}, []loaderTest{
+		{name: "a.html", want: "a"},
+		{name: "dir/b.html", want: "b"},
+		{name: "dir/../a.html", want: "a"},
+		{name: "./a.html", want: "a"},
+		{name: "missing.html", notFound: true},
+		{name: "dir/missing.html", notFound: true},
+		{name: "../a.html", invalid: true},
+		{name: "/a.html", invalid: true},
+		{name: "dir", invalid: true},
+	})
+}
+
+func TestFileSystemLoader(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(dir1, "a.html"):        "a1",
+		filepath.Join(dir1, "sub", "c.html"): "c1",
+		filepath.Join(dir2, "a.html"):        "a2",
+		filepath.Join(dir2, "b.html"):        "b2",
+	}
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testLoader(t, NewFileSystemLoader(dir1, dir2), []loaderTest{
+		{name: "a.html", want: "a1"},
+		{name: "b.html", want: "b2"},
+		{name: "sub/c.html", want: "c1"},
+		{name: "missing.html", notFound: true},
+		{name: "../a.html", invalid: true},
+		{name: "sub/../../a.html", invalid: true},
+	})
+	testLoader(t, NewFileSystemLoader(), []loaderTest{
+		{name: "a.html", notFound: true},
+	})
+}
+
+func TestChainLoader(t *testing.T) {
+	l := ChainLoader{
+		MapLoader{"a": "a1"},
+		FSLoader{FS: fstest.MapFS{"a": {Data: []byte("a2")}, "b": {Data: []byte("b2")}}},
+	}
+	testLoader(t, l, []loaderTest{
+		{name: "a", want: "a1"},
+		{name: "b", want: "b2"},
+		{name: "c", notFound: true},
+		{name: "../c", invalid: true},
+	})
+	testLoader(t, ChainLoader{}, []loaderTest{
+		{name: "a", notFound: true},
+	})
+}
+
+func TestPrefixLoader(t *testing.T) {
+	loaders := map[string]Loader{
+		"admin": MapLoader{"index.html": "admin", "a:b": "colon"},
+		"site":  MapLoader{"index.html": "site"},
+	}
+	testLoader(t, &PrefixLoader{Loaders: loaders}, []loaderTest{
+		{name: "admin:index.html", want: "admin"},
+		{name: "site:index.html", want: "site"},
+		{name: "admin:a:b", want: "colon"},
+		{name: "index.html", notFound: true},
+		{name: "other:index.html", notFound: true},
+		{name: "site:missing.html", notFound: true},
+		{name: "admin/index.html", notFound: true},
+	})
+	testLoader(t, &PrefixLoader{Loaders: loaders, Delimiter: "/"}, []loaderTest{
+		{name: "admin/index.html", want: "admin"},
+		{name: "admin:index.html", notFound: true},
+	})
+}
+
+func TestLoaderEnvironment(t *testing.T) {
+	env := NewEnvironment()
+	env.SetLoader(&PrefixLoader{Loaders: map[string]Loader{
+		"lib": MapLoader{"macros": "{% macro m() %}m{% endmacro %}"},
+	}})
+	runExecTests(t, env, []execTest{
+		{name: "import", tmpl: "{% from 'lib:macros' import m %}{{ m() }}", want: "m"},
+		{name: "missing", tmpl: "{% include 'lib:missing' %}", err: "cannot include template: missing: template not found"},
+	})
+}
@@ -1,15 +1,29 @@
-package main
+package xt
 
-import "fmt"
+import "reflect"
 
+// Tree is the representation of a single parsed template
 type Tree struct {
 	name  string
 	input string
 	lex   *lexer
+	env   *Environment
 	Root  []Node
 
+	delims *Delimiters // delimiters overriding those of the environment, if set
+
+	autoescape bool    // escape the output of variables parsed at the current position
+	ctx        context // HTML context at the current position, used to choose escapers
+
+	recovering bool      // continue parsing after syntax errors, see ParseAll
+	errors     ErrorList // syntax errors found when recovering
+
+	// Blocks contains all named blocks in the template, including nested blocks
+	Blocks map[string]*BlockStmt
+
 	items     [5]item
 	peekCount int
+	loopDepth int // number of for-loops surrounding the current position
 }
 
 // A Node is an element in the parse tree. The interface is trivial.
@@ -45,18 +59,31 @@ type Identifier struct {
 // Position returns the start position of the statement
 func (s *Identifier) Position() Pos { return s.Start }
 
-// NewTree creates a new parser tree
+// NewTree creates a new parser tree, using the default environment
 func NewTree(name string) *Tree {
-	return &Tree{name: name}
+	return defaultEnvironment.NewTree(name)
+}
+
+// Parse parses the template input using the default environment,
+// and returns the resulting tree
+func Parse(name, input string) (*Tree, error) {
+	t := NewTree(name)
+	if err := t.Parse(input); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Name returns the name of the template
+func (t *Tree) Name() string {
+	return t.name
 }
 
 func (t *Tree) next() item {
-	var i item
 	if t.peekCount > 0 {
 		t.peekCount--
 	} else {
-		i = <-t.lex.items
-		t.items[0] = i
+		t.items[0] = t.receive()
 	}
 	return t.items[t.peekCount]
 }
@@ -66,7 +93,7 @@ func (t *Tree) peek() item {
 		return t.items[t.peekCount-1]
 	}
 	t.peekCount = 1
-	t.items[0] = <-t.lex.items
+	t.items[0] = t.receive()
 	return t.items[0]
 }
 
@@ -75,12 +102,33 @@ func (t *Tree) consume() {
 		t.peekCount--
 		return
 	}
-	<-t.lex.items
+	t.receive()
+}
+
+// receive reads the next item from the lexer. The lexer stops after an error
+// unless it recovers, so once it has stopped, EOF is returned at the end of the input.
+func (t *Tree) receive() item {
+	i, ok := <-t.lex.items
+	if !ok {
+		pos := Pos(len(t.input))
+		line, col := t.Location(pos)
+		return item{typ: itemEOF, pos: pos, line: line, col: col}
+	}
+	return i
 }
 
+// consumeUntil skips tokens up to and including the first token of type it.
+// An error from the lexer is left for the caller, so that it is reported.
 func (t *Tree) consumeUntil(it itemType) {
-	for token := t.next(); token.typ != itemEOF &&
-		token.typ != it; token = t.next() {
+	for {
+		token := t.next()
+		switch token.typ {
+		case it, itemEOF:
+			return
+		case itemError:
+			t.backup(token)
+			return
+		}
 	}
 }
 
@@ -89,40 +137,148 @@ func (t *Tree) backup(i item) {
 	t.peekCount++
 }
 
+// SetDelimiters sets the delimiters used when parsing this template,
+// overriding the delimiters of the environment
+func (t *Tree) SetDelimiters(d Delimiters) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+	t.delims = &d
+	return nil
+}
+
 // Parse builds the AST based on input
 func (t *Tree) Parse(input string) error {
-	l := lex(t.name, input)
+	opts := t.env.lexOptions()
+	if t.delims != nil {
+		opts.delims = *t.delims
+	}
+	opts.recover = t.recovering
+	l := lex(t.name, input, opts)
 	t.lex = l
 	t.input = input
-	return t.parse()
+	t.Blocks = make(map[string]*BlockStmt)
+	t.autoescape = t.env.autoescapeFor(t.name)
+	t.ctx = context{}
+	t.errors = nil
+	err := t.parse()
+	if err != nil {
+		l.drain()
+	}
+	return err
+}
+
+// ParseAll builds the AST based on input like Parse, but does not stop at the
+// first syntax error. After an error, parsing continues after the end of the tag
+// or variable containing the error. If any errors are found, they are returned
+// as an ErrorList, and the tree contains the parts of the template that could be
+// parsed. The tree can be inspected, e.g. to lint a template, but should not be
+// executed.
+func (t *Tree) ParseAll(input string) error {
+	t.recovering = true
+	defer func() { t.recovering = false }()
+	return t.Parse(input)
+}
+
+func (t *Tree) parse() (err error) {
+	t.Root, _, err = t.itemList()
+	if err == nil && len(t.errors) > 0 {
+		return t.errors
+	}
+	return err
 }
 
-func (t *Tree) parse() error {
-	t.Root = []Node{}
-	for t.peek().typ != itemEOF {
+// itemList parses text, variables and tags until a tag with one of the
+// names in end is found, or until end of file.
+// The name of the end tag is consumed and returned, the rest of the end tag
+// is left for the caller to handle. If end of file is reached, the returned
+// item will have the type itemEOF.
+func (t *Tree) itemList(end ...string) (list []Node, endTag item, err error) {
+	list = []Node{}
+	for {
+		var n Node
 		token := t.next()
 		switch token.typ {
+		case itemEOF:
+			return list, token, nil
+		case itemError:
+			err = t.errorf("%s", token.val)
 		case itemText:
-			n := &TextValue{Text: token.val}
-			n.Start = token.pos
-			t.Root = append(t.Root, n)
+			n = &TextValue{Start: token.pos, Text: token.val}
+			t.ctx = t.ctx.advance(token.val)
+		case itemVarStart:
+			n, err = t.newVarStmt()
 		case itemTagStart:
-			n, err := t.tag()
-			if err != nil {
-				return err
+			tagname := t.peek()
+			for _, name := range end {
+				if tagname.val == name {
+					return list, t.next(), nil
+				}
 			}
-			t.Root = append(t.Root, n)
+			n, err = t.tag()
 		default:
-			return t.errorf("expected text or tag, got %s", token)
+			err = t.errorf("expected text or tag, got %s", token)
 		}
+		if err != nil {
+			if !t.recover(err) {
+				return nil, token, err
+			}
+			err = nil
+			continue
+		}
+		list = append(list, n)
 	}
-	return nil
 }
 
-// errorf returns an error token and terminates the scan by passing
-// back a nil pointer that will be the next state, terminating l.nextItem.
+// recover records the syntax error err and skips the rest of the tag or variable
+// where it was found, if the tree is parsed with ParseAll. It reports whether
+// parsing can continue.
+func (t *Tree) recover(err error) bool {
+	terr, ok := err.(*TemplateError)
+	if !t.recovering || !ok {
+		return false
+	}
+	t.errors = append(t.errors, terr)
+
+	// the end of the tag may already have been read, e.g. if the tag is incomplete
+	token := t.items[t.peekCount]
+	switch token.typ {
+	case itemTagEnd, itemVarEnd:
+		return true
+	case itemEOF:
+		t.backup(token)
+		return true
+	}
+	for {
+		token = t.next()
+		switch token.typ {
+		case itemTagEnd, itemVarEnd:
+			return true
+		case itemError:
+			// the lexer has skipped the rest of the tag, which is already
+			// reported, and emits the end of the tag if it was found
+			if next := t.peek(); next.typ == itemTagEnd || next.typ == itemVarEnd {
+				t.next()
+			}
+			return true
+		case itemEOF, itemText, itemTagStart, itemVarStart:
+			// the tag was not closed, continue with what follows it
+			t.backup(token)
+			return true
+		}
+	}
+}
+
+// errorf returns a syntax error at the position of the last token read
 func (t *Tree) errorf(format string, args ...interface{}) error {
-	return fmt.Errorf(format, args...)
+	return t.newError(SyntaxError, t.items[t.peekCount].pos, format, args...)
+}
+
+// Location returns the line and column of the byte position pos in the
+// template, e.g. the position of a node. Both line and column start at 1,
+// and the column is counted in runes.
+func (t *Tree) Location(pos Pos) (line, col int) {
+	return location(t.input, pos)
 }
 
 // tag parses a tag node. The initial opening brace has already been parsed
@@ -134,6 +290,30 @@ func (t *Tree) tag() (Node, error) {
 		return t.newBlockStmt()
 	case itemIf:
 		return t.newIfStmt()
+	case itemFor:
+		return t.newForStmt()
+	case itemBreak, itemContinue:
+		return t.newLoopControlStmt(tagname)
+	case itemExtends:
+		return t.newExtendsStmt()
+	case itemInclude:
+		return t.newIncludeStmt()
+	case itemAutoescape:
+		return t.newAutoescapeStmt()
+	case itemRaw:
+		return t.newRawStmt()
+	case itemMacro:
+		return t.newMacroStmt()
+	case itemCall:
+		return t.newCallStmt()
+	case itemImport:
+		return t.newImportStmt()
+	case itemFrom:
+		return t.newFromImportStmt()
+	case itemSet:
+		return t.newSetStmt()
+	case itemWith:
+		return t.newWithStmt()
 	}
 
 	return nil, t.errorf("unknown tag %s", tagname.val)
@@ -155,6 +335,31 @@ func walk(fn Walker, nodeList []Node) (err error) {
 			if err != nil {
 				return err
 			}
+		case *AutoescapeStmt:
+			err = walk(sub, nodeList[k].(*AutoescapeStmt).Body)
+			if err != nil {
+				return err
+			}
+		case *MacroStmt:
+			err = walk(sub, nodeList[k].(*MacroStmt).Body)
+			if err != nil {
+				return err
+			}
+		case *CallStmt:
+			err = walk(sub, []Node{nodeList[k].(*CallStmt).Caller})
+			if err != nil {
+				return err
+			}
+		case *SetStmt:
+			err = walk(sub, nodeList[k].(*SetStmt).Body)
+			if err != nil {
+				return err
+			}
+		case *WithStmt:
+			err = walk(sub, nodeList[k].(*WithStmt).Body)
+			if err != nil {
+				return err
+			}
 		case *IfStmt:
 			s := nodeList[k].(*IfStmt)
 			err = walk(sub, s.Body)
@@ -168,6 +373,17 @@ func walk(fn Walker, nodeList []Node) (err error) {
 					return err
 				}
 			}
+		case *ForStmt:
+			s := nodeList[k].(*ForStmt)
+			err = walk(sub, s.Body)
+			if err != nil {
+				return err
+			}
+
+			err = walk(sub, s.Else)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -176,3 +392,29 @@ func walk(fn Walker, nodeList []Node) (err error) {
 func (t *Tree) Walk(fn Walker) error {
 	return walk(fn, t.Root)
 }
+
+// inspect calls fn for each of nodes and the nodes nested in them, e.g. the
+// body of a statement or the operands of an expression, in depth-first order.
+// The nodes nested in a node are only inspected if fn returns true for it.
+func inspect(nodes []Node, fn func(Node) bool) {
+	for _, n := range nodes {
+		if n == nil || !fn(n) {
+			continue
+		}
+		v := reflect.Indirect(reflect.ValueOf(n))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		for k := 0; k < v.NumField(); k++ {
+			if !v.Field(k).CanInterface() {
+				continue
+			}
+			switch f := v.Field(k).Interface().(type) {
+			case Node:
+				inspect([]Node{f}, fn)
+			case []Node:
+				inspect(f, fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package xt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAll(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // positions and messages of the errors
+		text string   // text nodes of the parsed tree
+	}{
+		{"no errors", "a{{ x }}b", nil, "ab"},
+		{"one error", "a{{ ) }}b", []string{"1:5: unexpected"}, "ab"},
+		{"several errors", "a{% nosuchtag %}b\n{{ x y }}c{{ ) }}d", []string{
+			"1:5: unknown tag nosuchtag",
+			"2:6: ",
+			"2:14: unexpected",
+		}, "ab\ncd"},
+		{"error in body", "{% if x %}a{{ ) }}b{% endif %}c", []string{"1:15: unexpected"}, "abc"},
+		{"unclosed tag", "a{% if x b\n{{ ) }}c", []string{"1:", "2:4: unexpected"}, "ac"},
+		{"missing end tag", "{% if x %}a", []string{"1:12: expected 'endif'-tag, got end-of-file"}, ""},
+		{"unmatched end tag", "a{% endif %}b", []string{"1:5: unknown tag endif"}, "ab"},
+		{"lexer errors", "a{{ 'x }}b{{ ) }}", []string{"1:5: unterminated quoted string"}, "a"},
+		{"lexer error after error", "a{{ ) 'x }}\nb{{ ) }}", []string{"1:5: unexpected", "2:5: unexpected"}, "a\nb"},
+		{"lexer error in tag", "{% if x %}{{ 'a }}\n{% endif %}", []string{"1:14: unterminated quoted string"}, ""},
+		{"incomplete end tag", "{% if x %}a{% endif %", []string{"1:22: unclosed action"}, "a"},
+		{"incomplete endfor", "{% for x in y %}{% endfor", []string{"1:26: unclosed action"}, ""},
+		{"incomplete endblock", "{% block b %}{% endblock %", []string{"1:27: unclosed action"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := NewTree(test.name)
+			var err error
+			timeout(t, func() { err = tree.ParseAll(test.src) })
+
+			var list ErrorList
+			if test.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			} else if !errors.As(err, &list) {
+				t.Fatalf("expected an ErrorList, got %v", err)
+			}
+			if len(list) != len(test.want) {
+				t.Fatalf("expected %d errors, got %d: %v", len(test.want), len(list), []*TemplateError(list))
+			}
+			for k, e := range list {
+				got := fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Message)
+				if !strings.HasPrefix(got, test.want[k]) || e.Kind != SyntaxError {
+					t.Errorf("error %d: expected %q, got %s %q", k, test.want[k], e.Kind, got)
+				}
+			}
+
+			var text strings.Builder
+			inspect(tree.Root, func(n Node) bool {
+				if n, ok := n.(*TextValue); ok {
+					text.WriteString(n.Text)
+				}
+				return true
+			})
+			if text.String() != test.text {
+				t.Errorf("expected the text %q in the tree, got %q", test.text, text.String())
+			}
+		})
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	e1 := &TemplateError{Kind: SyntaxError, Name: "t", Line: 1, Col: 2, Message: "first"}
+	e2 := &TemplateError{Kind: SyntaxError, Name: "t", Line: 3, Col: 4, Message: "second"}
+	for _, test := range []struct {
+		list ErrorList
+		want string
+	}{
+		{ErrorList{}, "no errors"},
+		{ErrorList{e1}, "t:1:2: first"},
+		{ErrorList{e1, e2}, "t:1:2: first (and 1 more errors)"},
+	} {
+		if got := test.list.Error(); got != test.want {
+			t.Errorf("expected %q, got %q", test.want, got)
+		}
+	}
+
+	var err error = ErrorList{e1, e2}
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr != e1 || !errors.Is(err, e2) {
+		t.Fatalf("expected the errors to be unwrapped, got %v", terr)
+	}
+}
+
+func TestParseAllThenParse(t *testing.T) {
+	// the tree stops recovering after ParseAll
+	tree := NewTree("t")
+	if err := tree.ParseAll("{{ ) }}{{ ) }}"); err == nil {
+		t.Fatal("expected errors")
+	}
+	err := tree.Parse("{{ ) }}{{ ) }}")
+	var terr *TemplateError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a single TemplateError, got %v", err)
+	}
+}
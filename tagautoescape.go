@@ -0,0 +1,47 @@
+package xt
+
+// AutoescapeStmt enables or disables autoescaping of variables in its body,
+// overriding the setting of the environment
+type AutoescapeStmt struct {
+	Start   Pos
+	Enabled bool
+	Body    []Node
+}
+
+// Position returns the start position of the statement
+func (s *AutoescapeStmt) Position() Pos { return s.Start }
+
+// autoescape statement:
+//  {% autoescape <true|false> %}
+//    ...
+//  {% endautoescape %}
+func (t *Tree) newAutoescapeStmt() (n Node, err error) {
+	start := t.items[0]
+	token := t.next()
+	if token.typ != itemBool {
+		return nil, t.errorf("expected 'true' or 'false', got %s", token)
+	}
+	if t.next().typ != itemTagEnd {
+		return nil, t.errorf("expected end tag, got %s", t.items[0])
+	}
+
+	stmt := &AutoescapeStmt{
+		Start:   start.pos,
+		Enabled: token.val == "true",
+	}
+
+	prev := t.autoescape
+	t.autoescape = stmt.Enabled
+	body, end, err := t.itemList("endautoescape")
+	t.autoescape = prev
+	if err != nil {
+		return nil, err
+	}
+	if end.typ == itemEOF {
+		return nil, t.errorf("expected 'endautoescape'-tag, got end-of-file")
+	}
+	t.consumeUntil(itemTagEnd)
+
+	stmt.Body = body
+	return stmt, nil
+}
@@ -0,0 +1,58 @@
+package xt
+
+import "testing"
+
+func TestAutoescape(t *testing.T) {
+	env := newTestEnv(map[string]string{
+		"part.html":  "<i>{{ x }}</i>",
+		"part.txt":   "<i>{{ x }}</i>",
+		"macros.txt": "{% macro m(v) %}<{{ v }}>{% endmacro %}",
+	})
+	env.SetAutoescape(AutoescapeExtensions())
+	data := map[string]interface{}{"x": "<a&b>", "m": Markup("<b>"), "n": 1}
+	runExecTests(t, env, []execTest{
+		{name: "text.html", tmpl: "<p>{{ x }}</p>", data: data, want: "<p>&lt;a&amp;b&gt;</p>"},
+		{name: "text.txt", tmpl: "<p>{{ x }}</p>", data: data, want: "<p><a&b></p>"},
+		{name: "upper.HTML", tmpl: "{{ x }}", data: data, want: "&lt;a&amp;b&gt;"},
+		{name: "xml.xml", tmpl: "{{ x }}", data: data, want: "&lt;a&amp;b&gt;"},
+		{name: "number.html", tmpl: "{{ n }}", data: data, want: "1"},
+		{name: "safe.html", tmpl: "{{ x | safe }}", data: data, want: "<a&b>"},
+		{name: "markup.html", tmpl: "{{ m }}", data: data, want: "<b>"},
+		{name: "escape filter.txt", tmpl: "{{ x | escape }}", data: data, want: "&lt;a&amp;b&gt;"},
+		{name: "escape once.html", tmpl: "{{ x | escape }}", data: data, want: "&lt;a&amp;b&gt;"},
+		{name: "expression.html", tmpl: "{{ x + '!' }}{{ m | upper }}", data: data, want: "&lt;a&amp;b&gt;!&lt;B&gt;"},
+		{name: "literal.html", tmpl: "{{ '<b>' }}", want: "&lt;b&gt;"},
+
+		{name: "disabled.html", tmpl: "{% autoescape false %}{{ x }}{% endautoescape %}{{ x }}", data: data, want: "<a&b>&lt;a&amp;b&gt;"},
+		{name: "enabled.txt", tmpl: "{% autoescape true %}{{ x }}{% endautoescape %}{{ x }}", data: data, want: "&lt;a&amp;b&gt;<a&b>"},
+		{name: "nested.txt", tmpl: "{% autoescape true %}{% autoescape false %}{{ x }}{% endautoescape %}{{ x }}{% endautoescape %}", data: data, want: "<a&b>&lt;a&amp;b&gt;"},
+		{name: "block.txt", tmpl: "{% autoescape true %}{% block b %}{{ x }}{% endblock %}{% endautoescape %}", data: data, want: "&lt;a&amp;b&gt;"},
+
+		{name: "include html.txt", tmpl: "{% include 'part.html' %}", data: data, want: "<i>&lt;a&amp;b&gt;</i>"},
+		{name: "include text.html", tmpl: "{% include 'part.txt' %}", data: data, want: "<i><a&b></i>"},
+		{name: "macro.html", tmpl: "{% macro m(v) %}<{{ v }}>{% endmacro %}{{ m(x) }}", data: data, want: "<&lt;a&amp;b&gt;>"},
+		{name: "macro from text.html", tmpl: "{% from 'macros.txt' import m %}{{ m(x) }}", data: data, want: "&lt;&lt;a&amp;b&gt;&gt;"},
+		{name: "macro with markup.html", tmpl: "{% macro m() %}{{ caller() }}{% endmacro %}{% call m() %}<b>{% endcall %}", want: "<b>"},
+		{name: "block set.html", tmpl: "{% set s %}<b>{{ x }}</b>{% endset %}{{ s }}", data: data, want: "<b>&lt;a&amp;b&gt;</b>"},
+
+		{name: "missing value.html", tmpl: "{% autoescape %}{% endautoescape %}", err: "expected 'true' or 'false', got right-delim"},
+		{name: "unterminated.html", tmpl: "{% autoescape true %}", err: "expected 'endautoescape'-tag, got end-of-file"},
+	})
+}
+
+func TestAutoescapeExtensions(t *testing.T) {
+	fn := AutoescapeExtensions(".tmpl", ".HTM")
+	for name, want := range map[string]bool{
+		"a.tmpl":      true,
+		"a.TMPL":      true,
+		"a.htm":       true,
+		"a.html":      false,
+		"dir.tmpl/a":  false,
+		"tmpl":        false,
+		"a.tmpl.json": false,
+	} {
+		if got := fn(name); got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
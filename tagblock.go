@@ -1,4 +1,4 @@
-package main
+package xt
 
 // BlockStmt defines a block in a template
 // Unnamed blocks, with name set to "", can be used to
@@ -21,38 +21,31 @@ func (t *Tree) newBlockStmt() (n Node, err error) {
 		return nil, t.errorf("expected identifier, got %s", blockName)
 	}
 
-	if t.next().typ != itemTagEnd {
-		return nil, t.errorf("expected end tag, got %s", t.peek())
+	if token := t.next(); token.typ != itemTagEnd {
+		return nil, t.errorf("expected end tag, got %s", token)
 	}
+	if _, ok := t.Blocks[blockName.val]; ok {
+		return nil, t.errorf("block '%s' defined more than once", blockName.val)
+	}
+	// reserve the name, so that nested blocks cannot reuse it
+	t.Blocks[blockName.val] = nil
 
 	// now parse the contents of block
-	body := []Node{}
-Loop:
-	for token := t.next(); token.typ != itemEOF; token = t.next() {
-		switch token.typ {
-		case itemText:
-			n = &TextValue{Start: token.pos, Text: token.val}
-		case itemTagStart:
-			tagname := t.peek()
-			if tagname.typ == itemIdentifier &&
-				tagname.val == "endblock" {
-				t.consumeUntil(itemTagEnd)
-				break Loop
-			}
-
-			n, err = t.tag()
-			if err != nil {
-				return nil, err
-			}
-		}
-		body = append(body, n)
+	body, end, err := t.itemList("endblock")
+	if err != nil {
+		return nil, err
+	}
+	if end.typ == itemEOF {
+		return nil, t.errorf("expected 'endblock'-tag, got end-of-file")
 	}
+	t.consumeUntil(itemTagEnd)
 
 	block := &BlockStmt{
 		Start: blockName.pos,
 		Name:  blockName.val,
 		Body:  body,
 	}
+	t.Blocks[block.Name] = block
 
 	return block, nil
 }
@@ -0,0 +1,163 @@
+package xt
+
+import (
+	"io"
+	"strings"
+)
+
+// ExtendsStmt defines that a template extends another template.
+// The output of the template is the output of the parent template,
+// with the blocks of the parent replaced by the blocks of the child template.
+type ExtendsStmt struct {
+	Start    Pos
+	Template Node // expression evaluating to the name of the parent template
+}
+
+// Position returns the start position of the statement
+func (s *ExtendsStmt) Position() Pos { return s.Start }
+
+// SuperExpr represents a call to 'super()' inside a block, which
+// evaluates to the contents of the block in the parent template
+type SuperExpr struct {
+	Start Pos
+}
+
+// Position returns the start position of the statement
+func (s *SuperExpr) Position() Pos { return s.Start }
+
+// blockDef is a block, together with the template it is defined in
+type blockDef struct {
+	tree  *Tree
+	block *BlockStmt
+}
+
+// blockRef refers to a block being rendered, at the given level of
+// the chain of overridden blocks
+type blockRef struct {
+	name  string
+	level int
+}
+
+// extends statement:
+//  {% extends expression %}
+func (t *Tree) newExtendsStmt() (n Node, err error) {
+	start := t.items[0]
+	expression, err := t.expression(itemTagEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &ExtendsStmt{
+		Start:    start.pos,
+		Template: expression,
+	}
+	return stmt, nil
+}
+
+// super expression:
+//  super()
+func (t *Tree) newSuperExpr(token item) (Node, error) {
+	t.next()
+	if next := t.next(); next.typ != itemRightParen {
+		return nil, t.errorf("super() takes no arguments, got %s", next)
+	}
+	return &SuperExpr{Start: token.pos}, nil
+}
+
+// executeTree executes the template t. If t extends another template,
+// the parent template is executed after t, repeating for every level of inheritance.
+func (s *state) executeTree(t *Tree) error {
+	wr := s.wr
+	defer func() { s.wr = wr }()
+
+	s.chain = make(map[string]bool)
+	for t != nil {
+		s.tree = t
+		s.chain[t.name] = true
+		for name, block := range t.Blocks {
+			s.blocks[name] = append(s.blocks[name], blockDef{tree: t, block: block})
+		}
+
+		s.parent = nil
+		if err := s.walkList(t.Root); err != nil {
+			return err
+		}
+		s.wr = wr
+		t = s.parent
+	}
+	return nil
+}
+
+// walkExtends loads the parent template, which will be executed when
+// the current template has been executed. Any output after the extends
+// statement is discarded.
+func (s *state) walkExtends(n *ExtendsStmt) error {
+	if s.parent != nil {
+		return s.errorf("template extends more than one template")
+	}
+
+	val, err := s.evalExpr(n.Template)
+	if err != nil {
+		return err
+	}
+	name, ok := toString(val)
+	if !ok {
+		return s.errorf("template name must be a string, got %T", val)
+	}
+
+	s.parent, err = s.tree.env.GetTemplate(name)
+	if err != nil {
+		return s.errorf("cannot extend template: %s", err)
+	}
+	if s.chain[s.parent.name] {
+		return s.errorf("cannot extend template '%s': cyclic inheritance", name)
+	}
+	s.wr = io.Discard
+	return nil
+}
+
+// walkBlock renders the most derived version of the block n
+func (s *state) walkBlock(n *BlockStmt) error {
+	if s.parent != nil {
+		// the current template extends another template, so the block
+		// will be rendered when the block is encountered in the parent
+		return nil
+	}
+	return s.renderBlock(blockRef{name: n.Name})
+}
+
+// renderBlock renders the block at the given level of inheritance
+func (s *state) renderBlock(ref blockRef) error {
+	chain := s.blocks[ref.name]
+	if ref.level >= len(chain) {
+		return s.errorf("block '%s' has no parent block", ref.name)
+	}
+
+	// variables assigned in the block are local to the block
+	prev, tree, mark := s.block, s.tree, s.mark()
+	s.block, s.tree = &ref, chain[ref.level].tree
+	s.scopes++
+	defer func() {
+		s.block, s.tree = prev, tree
+		s.scopes--
+		s.pop(mark)
+	}()
+	return s.walkList(chain[ref.level].block.Body)
+}
+
+// evalSuper renders the parent version of the current block
+func (s *state) evalSuper(n *SuperExpr) (interface{}, error) {
+	if s.block == nil {
+		return nil, s.errorf("super() used outside of block")
+	}
+
+	var sb strings.Builder
+	wr := s.wr
+	s.wr = &sb
+	err := s.renderBlock(blockRef{name: s.block.name, level: s.block.level + 1})
+	s.wr = wr
+	if err != nil {
+		return nil, err
+	}
+	return Markup(sb.String()), nil
+}
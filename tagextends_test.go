@@ -0,0 +1,43 @@
+package xt
+
+import "testing"
+
+func TestExtendsStmt(t *testing.T) {
+	env := newTestEnv(map[string]string{
+		"base":   "<{% block title %}base{% endblock %}|{% block body %}body{% endblock %}>",
+		"middle": "{% extends 'base' %}{% block title %}middle:{{ super() }}{% endblock %}",
+		"nested": "[{% block outer %}o{% block inner %}i{% endblock %}{% endblock %}]",
+		"vars":   "{% block b %}{{ x }}{% endblock %}",
+		"broken": "{% extends 'missing' %}",
+		"cycle1": "{% extends 'cycle2' %}",
+		"cycle2": "{% extends 'cycle1' %}",
+		"self":   "{% extends 'self' %}",
+	})
+	runExecTests(t, env, []execTest{
+		{name: "no blocks", tmpl: "{% extends 'base' %}", want: "<base|body>"},
+		{name: "override", tmpl: "{% extends 'base' %}{% block body %}child{% endblock %}", want: "<base|child>"},
+		{name: "super", tmpl: "{% extends 'base' %}{% block body %}{{ super() }}+child{% endblock %}", want: "<base|body+child>"},
+		{name: "output after extends", tmpl: "before{% extends 'base' %}after{% block title %}t{% endblock %}after", want: "before<t|body>"},
+		{name: "expression", tmpl: "{% extends layout %}", data: map[string]string{"layout": "base"}, want: "<base|body>"},
+		{name: "multi-level", tmpl: "{% extends 'middle' %}{% block body %}child{% endblock %}", want: "<middle:base|child>"},
+		{name: "multi-level super", tmpl: "{% extends 'middle' %}{% block title %}child:{{ super() }}{% endblock %}", want: "<child:middle:base|body>"},
+		{name: "nested block", tmpl: "{% extends 'nested' %}{% block inner %}I{% endblock %}", want: "[oI]"},
+		{name: "nested override", tmpl: "{% extends 'nested' %}{% block outer %}O{% endblock %}", want: "[O]"},
+		{name: "data", tmpl: "{% extends 'vars' %}", data: map[string]int{"x": 1}, want: "1"},
+		{name: "top level set", tmpl: "{% extends 'vars' %}{% set x = 2 %}", want: "2"},
+		{name: "block outside extends", tmpl: "a{% block b %}b{% endblock %}c", want: "abc"},
+
+		{name: "super without parent", tmpl: "{% block b %}{{ super() }}{% endblock %}", err: "block 'b' has no parent block"},
+		{name: "super outside block", tmpl: "{{ super() }}", err: "super() used outside of block"},
+		{name: "super with arguments", tmpl: "{% block b %}{{ super(1) }}{% endblock %}", err: "super() takes no arguments"},
+		{name: "block extra argument", tmpl: "{% block a b %}{% endblock %}", err: `block extra argument:1:12: expected end tag, got identifier "b"`},
+		{name: "duplicate block", tmpl: "{% block b %}{% endblock %}{% block b %}{% endblock %}", err: "block 'b' defined more than once"},
+		{name: "duplicate nested block", tmpl: "{% block b %}{% block b %}{% endblock %}{% endblock %}", err: "block 'b' defined more than once"},
+		{name: "extends twice", tmpl: "{% extends 'base' %}{% extends 'base' %}", err: "template extends more than one template"},
+		{name: "missing parent", tmpl: "{% extends 'missing' %}", err: "cannot extend template"},
+		{name: "missing grandparent", tmpl: "{% extends 'broken' %}", err: "cannot extend template"},
+		{name: "cycle", tmpl: "{% extends 'cycle1' %}", err: "cycle2:1:12: cannot extend template 'cycle1': cyclic inheritance"},
+		{name: "extends itself", tmpl: "{% extends 'self' %}", err: "self:1:12: cannot extend template 'self': cyclic inheritance"},
+		{name: "name not a string", tmpl: "{% extends 1 %}", err: "template name must be a string, got int"},
+	})
+}
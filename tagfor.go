@@ -0,0 +1,295 @@
+package xt
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+)
+
+// ForStmt defines a for-loop.
+// Body is executed once for every element in Seq, with the element assigned
+// to the variables in Vars. If Seq is empty, Else is executed instead.
+type ForStmt struct {
+	Start Pos
+	Vars  []string
+	Seq   Node
+	Body  []Node
+	Else  []Node
+
+	Lookahead bool // the body uses loop.last, so the next element is read before each iteration
+	Collect   bool // the body uses the length of Seq, so all elements are read before the loop
+}
+
+// Position returns the start position of the statement
+func (s *ForStmt) Position() Pos { return s.Start }
+
+// LoopControlStmt defines a 'break' or 'continue' statement inside a for-loop
+type LoopControlStmt struct {
+	Start    Pos
+	Continue bool
+}
+
+// Position returns the start position of the statement
+func (s *LoopControlStmt) Position() Pos { return s.Start }
+
+// Loop holds information about the current iteration of a for-loop.
+// It is available as the variable 'loop' inside the loop body.
+// The sequence is read one element at a time, so Last is only set if the body
+// uses loop.last, and Revindex, Revindex0 and Length only if the body uses
+// any of them, which requires reading the whole sequence before the loop.
+type Loop struct {
+	Index     int   // current iteration, starting at 1
+	Index0    int   // current iteration, starting at 0
+	Revindex  int   // number of iterations until the end, ending at 1
+	Revindex0 int   // number of iterations until the end, ending at 0
+	First     bool  // true if this is the first iteration
+	Last      bool  // true if this is the last iteration
+	Length    int   // number of elements in the sequence
+	Depth     int   // level of nesting, starting at 1
+	Depth0    int   // level of nesting, starting at 0
+	Parent    *Loop // loop information of the surrounding loop, or nil
+}
+
+// errBreak and errContinue are used to unwind the execution of a loop body
+// when encountering 'break' or 'continue'
+var (
+	errBreak    = errors.New("break outside of loop")
+	errContinue = errors.New("continue outside of loop")
+)
+
+// for statement:
+//  {% for <var:identifier>[, <var:identifier>...] in expression %}
+//  [{% else %}]
+//  {% endfor %}
+func (t *Tree) newForStmt() (n Node, err error) {
+	start := t.items[0]
+
+	var vars []string
+	for {
+		token := t.next()
+		if token.typ != itemIdentifier {
+			return nil, t.errorf("expected identifier, got %s", token)
+		}
+		vars = append(vars, token.val)
+
+		token = t.next()
+		if isWord(token, "in") {
+			break
+		}
+		if !isChar(token, ",") {
+			return nil, t.errorf("expected ',' or 'in', got %s", token)
+		}
+	}
+
+	seq, err := t.expression(itemTagEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	t.loopDepth++
+	body, end, err := t.itemList("else", "endfor")
+	t.loopDepth--
+	if err != nil {
+		return nil, err
+	}
+
+	var elseBody []Node
+	if end.typ == itemElse {
+		if token := t.next(); token.typ != itemTagEnd {
+			return nil, t.errorf("unexpected extra arguments to 'else' statement: %s", token)
+		}
+		elseBody, end, err = t.itemList("endfor")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if end.typ == itemEOF {
+		return nil, t.errorf("expected 'endfor'-tag, got end-of-file")
+	}
+	t.consumeUntil(itemTagEnd)
+
+	stmt := &ForStmt{
+		Start: start.pos,
+		Vars:  vars,
+		Seq:   seq,
+		Body:  body,
+		Else:  elseBody,
+	}
+	stmt.Lookahead, stmt.Collect = loopUsage(body)
+	return stmt, nil
+}
+
+// loopUsage reports how the body of a for-loop uses the variable 'loop'.
+// lookahead is set if loop.last is used, and collect if the length of the
+// sequence is used, e.g. loop.length. collect is also set if it cannot be
+// decided which attributes are used, e.g. if 'loop' is passed to a macro, or
+// if the body includes a template or a block, which sees the loop variables.
+func loopUsage(body []Node) (lookahead, collect bool) {
+	inspect(body, func(n Node) bool {
+		switch n := n.(type) {
+		case *AttrExpr:
+			if id, ok := n.X.(*Identifier); ok && id.Name == "loop" {
+				switch strings.ToLower(n.Name) {
+				case "index", "index0", "first", "depth", "depth0":
+				case "last":
+					lookahead = true
+				default:
+					collect = true
+				}
+				return false
+			}
+		case *Identifier:
+			collect = collect || n.Name == "loop"
+		case *IncludeStmt:
+			collect = collect || !n.Only
+		case *ImportStmt:
+			collect = collect || n.WithContext
+		case *FromImportStmt:
+			collect = collect || n.WithContext
+		case *BlockStmt:
+			collect = collect || n.Name != ""
+		case *SuperExpr:
+			collect = true
+		}
+		return true
+	})
+	return lookahead, collect
+}
+
+// break and continue statements:
+//  {% break %}
+//  {% continue %}
+func (t *Tree) newLoopControlStmt(tagname item) (n Node, err error) {
+	if t.loopDepth == 0 {
+		return nil, t.errorf("'%s' used outside of loop", tagname.val)
+	}
+	if token := t.next(); token.typ != itemTagEnd {
+		return nil, t.errorf("unexpected extra arguments to '%s' statement: %s", tagname.val, token)
+	}
+
+	stmt := &LoopControlStmt{
+		Start:    tagname.pos,
+		Continue: tagname.typ == itemContinue,
+	}
+	return stmt, nil
+}
+
+// walkFor executes a for-loop
+func (s *state) walkFor(n *ForStmt) error {
+	val, err := s.evalExpr(n.Seq)
+	if err != nil {
+		return err
+	}
+	seq, err := sequence(val)
+	if err != nil {
+		return s.errorf("%s", err)
+	}
+	// a panic in the sequence ends the loop, and is reported as an error
+	var seqErr error
+	seq = safeSeq(seq, &seqErr)
+	panicked := func() error {
+		s.at(n.Seq)
+		return s.errorf("%s", seqErr)
+	}
+
+	loop := &Loop{
+		Depth:  1,
+		Parent: s.loop,
+	}
+	if s.loop != nil {
+		loop.Depth = s.loop.Depth + 1
+	}
+	loop.Depth0 = loop.Depth - 1
+
+	if n.Collect {
+		elements := slices.Collect(seq)
+		if seqErr != nil {
+			return panicked()
+		}
+		loop.Length = len(elements)
+		seq = slices.Values(elements)
+	}
+	lookahead := n.Lookahead || n.Collect
+
+	next, stop := iter.Pull(seq)
+	defer stop()
+	element, ok := next()
+	if seqErr != nil {
+		return panicked()
+	}
+	if !ok {
+		return s.walkList(n.Else)
+	}
+
+	s.loop = loop
+	defer func() { s.loop = loop.Parent }()
+
+	for k := 0; ok; k++ {
+		var following []interface{}
+		var more bool
+		if lookahead {
+			following, more = next()
+			if seqErr != nil {
+				return panicked()
+			}
+		}
+		loop.Index0 = k
+		loop.Index = k + 1
+		loop.First = k == 0
+		loop.Last = lookahead && !more
+		if n.Collect {
+			loop.Revindex = loop.Length - k
+			loop.Revindex0 = loop.Length - k - 1
+		}
+
+		mark := s.mark()
+		s.scopes++
+		s.push("loop", loop)
+		if err = s.assign(n.Vars, element); err == nil {
+			err = s.walkList(n.Body)
+		}
+		s.scopes--
+		s.pop(mark)
+
+		if err == errBreak {
+			break
+		}
+		if err != nil && err != errContinue {
+			return err
+		}
+
+		if lookahead {
+			element, ok = following, more
+		} else if element, ok = next(); seqErr != nil {
+			return panicked()
+		}
+	}
+	return nil
+}
+
+// assign assigns an element of a sequence to the loop variables in names.
+// If there is more than one variable, the element is unpacked.
+func (s *state) assign(names []string, element []interface{}) error {
+	if len(names) == 1 {
+		s.push(names[0], element[0])
+		return nil
+	}
+
+	values := element
+	if len(element) == 1 {
+		var err error
+		values, err = unpack(element[0], len(names))
+		if err != nil {
+			return s.errorf("%s", err)
+		}
+	}
+	if len(values) != len(names) {
+		return s.errorf("cannot unpack %d values into %d variables", len(values), len(names))
+	}
+
+	for k, name := range names {
+		s.push(name, values[k])
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package xt
+
+import (
+	"errors"
+	"iter"
+	"testing"
+)
+
+func TestForStmt(t *testing.T) {
+	data := map[string]interface{}{
+		"items":  []string{"a", "b", "c"},
+		"empty":  []int{},
+		"m":      map[string]int{"b": 2, "a": 1},
+		"pairs":  [][]interface{}{{"x", 1}, {"y", 2}},
+		"nested": [][]int{{1, 2}, {3}},
+		"seq": iter.Seq[int](func(yield func(int) bool) {
+			for i := 1; i <= 3 && yield(i); i++ {
+			}
+		}),
+		"seq2": iter.Seq2[string, int](func(yield func(string, int) bool) {
+			_ = yield("a", 1) && yield("b", 2)
+		}),
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "slice", tmpl: "{% for x in items %}{{ x }}{% endfor %}", data: data, want: "abc"},
+		{name: "string", tmpl: `{% for c in "héj" %}[{{ c }}]{% endfor %}`, want: "[h][é][j]"},
+		{name: "list literal", tmpl: "{% for x in [1, 2] %}{{ x }}{% endfor %}", want: "12"},
+		{name: "map", tmpl: "{% for k, v in m %}{{ k }}={{ v }};{% endfor %}", data: data, want: "a=1;b=2;"},
+		{name: "map keys", tmpl: "{% for k in m %}{{ k }}{% endfor %}", data: data, want: "ab"},
+		{name: "unpacking", tmpl: "{% for a, b in pairs %}{{ a }}{{ b }}{% endfor %}", data: data, want: "x1y2"},
+		{name: "else", tmpl: "{% for x in empty %}{{ x }}{% else %}none{% endfor %}", data: data, want: "none"},
+		{name: "else undefined", tmpl: "{% for x in missing %}{{ x }}{% else %}none{% endfor %}", want: "none"},
+		{name: "else not empty", tmpl: "{% for x in items %}{{ x }}{% else %}none{% endfor %}", data: data, want: "abc"},
+		{name: "loop index", tmpl: "{% for x in items %}{{ loop.index }}{{ loop.index0 }}{% endfor %}", data: data, want: "102132"},
+		{name: "loop revindex", tmpl: "{% for x in items %}{{ loop.revindex }}{{ loop.revindex0 }}{% endfor %}", data: data, want: "322110"},
+		{name: "loop first last", tmpl: "{% for x in items %}{% if loop.first %}<{% endif %}{{ x }}{% if loop.last %}>{% endif %}{% endfor %}", data: data, want: "<abc>"},
+		{name: "loop length", tmpl: "{% for x in items %}{{ loop.length }}{% endfor %}", data: data, want: "333"},
+		{name: "loop depth", tmpl: "{% for l in nested %}{% for x in l %}{{ loop.depth }}{{ loop.parent.index }}{% endfor %}{% endfor %}", data: data, want: "212122"},
+		{name: "nested", tmpl: "{% for l in nested %}[{% for x in l %}{{ x }}{% endfor %}]{% endfor %}", data: data, want: "[12][3]"},
+		{name: "break", tmpl: "{% for x in items %}{% if x == 'b' %}{% break %}{% endif %}{{ x }}{% endfor %}", data: data, want: "a"},
+		{name: "continue", tmpl: "{% for x in items %}{% if x == 'b' %}{% continue %}{% endif %}{{ x }}{% endfor %}", data: data, want: "ac"},
+		{name: "break inner loop", tmpl: "{% for l in nested %}{% for x in l %}{{ x }}{% break %}{% endfor %}{% endfor %}", data: data, want: "13"},
+		{name: "loop variable scope", tmpl: "{% for x in items %}{% endfor %}[{{ x }}]", data: data, want: "[]"},
+		{name: "iter.Seq", tmpl: "{% for x in seq %}{{ x }}{% endfor %}", data: data, want: "123"},
+		{name: "iter.Seq2", tmpl: "{% for k, v in seq2 %}{{ k }}{{ v }}{% endfor %}", data: data, want: "a1b2"},
+		{name: "not iterable", tmpl: "{% for x in 5 %}{% endfor %}", err: "cannot iterate over int"},
+		{name: "unpack mismatch", tmpl: "{% for a, b, c in pairs %}{% endfor %}", data: data, err: "cannot unpack 2 values into 3 variables"},
+		{name: "break outside loop", tmpl: "{% break %}", err: "'break' used outside of loop"},
+		{name: "missing endfor", tmpl: "{% for x in items %}", err: "expected 'endfor'-tag"},
+		{name: "missing in", tmpl: "{% for x items %}{% endfor %}", err: "expected ',' or 'in'"},
+	})
+}
+
+func TestForStmtChannel(t *testing.T) {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "channel", tmpl: "{% for x in ch %}{{ x }}{% endfor %}", data: map[string]interface{}{"ch": ch}, want: "123"},
+	})
+}
+
+func TestForStmtLazy(t *testing.T) {
+	naturals := iter.Seq[int](func(yield func(int) bool) {
+		for i := 1; yield(i); i++ {
+		}
+	})
+	// the channel is never closed, and only holds the elements read by the loops
+	ch := make(chan int, 5)
+	for i := 1; i <= 5; i++ {
+		ch <- i
+	}
+	data := map[string]interface{}{"naturals": naturals, "ch": ch}
+
+	timeout(t, func() {
+		runExecTests(t, NewEnvironment(), []execTest{
+			{name: "infinite sequence", tmpl: "{% for x in naturals %}{{ x }}{% if x == 3 %}{% break %}{% endif %}{% endfor %}", data: data, want: "123"},
+			{name: "infinite sequence with loop.last", tmpl: "{% for x in naturals %}{{ loop.last }}{% if loop.index == 2 %}{% break %}{% endif %}{% endfor %}", data: data, want: "falsefalse"},
+			{name: "unclosed channel", tmpl: "{% for x in ch %}{{ x }}{% if x == 2 %}{% break %}{% endif %}{% endfor %}", data: data, want: "12"},
+			{name: "unclosed channel with loop.last", tmpl: "{% for x in ch %}{{ x }}{{ loop.last }}{% if x == 4 %}{% break %}{% endif %}{% endfor %}", data: data, want: "3false4false"},
+			{name: "first filter", tmpl: "{{ naturals | first }}", data: data, want: "1"},
+		})
+	})
+}
+
+func TestForStmtPanic(t *testing.T) {
+	// the sequences panic after yielding two elements
+	failing := iter.Seq[int](func(yield func(int) bool) {
+		_ = yield(1) && yield(2)
+		panic("failed")
+	})
+	failing2 := iter.Seq2[int, error](func(yield func(int, error) bool) {
+		_ = yield(1, nil) && yield(2, nil)
+		panic(errors.New("failed"))
+	})
+	empty := iter.Seq[int](func(yield func(int) bool) { panic("failed") })
+	data := map[string]interface{}{"failing": failing, "failing2": failing2, "empty": empty}
+
+	timeout(t, func() {
+		runExecTests(t, NewEnvironment(), []execTest{
+			{name: "panic", tmpl: "{% for x in failing %}{{ x }}{% endfor %}", data: data, err: "panic:1:13: panic: failed"},
+			{name: "panic with error", tmpl: "{% for k, v in failing2 %}{{ k }}{% endfor %}", data: data, err: "panic with error:1:16: panic: failed"},
+			{name: "panic before first element", tmpl: "{% for x in empty %}{% else %}else{% endfor %}", data: data, err: "panic: failed"},
+			{name: "panic with loop.last", tmpl: "{% for x in failing %}{{ loop.last }}{% endfor %}", data: data, err: "panic: failed"},
+			{name: "panic with loop.length", tmpl: "{% for x in failing %}{{ loop.length }}{% endfor %}", data: data, err: "panic: failed"},
+			{name: "break before panic", tmpl: "{% for x in failing %}{{ x }}{% break %}{% endfor %}", data: data, want: "1"},
+			{name: "filter", tmpl: "{{ failing | join }}", data: data, err: "panic: failed"},
+		})
+	})
+}
+
+func TestLoopUsage(t *testing.T) {
+	tests := []struct {
+		tmpl      string
+		lookahead bool
+		collect   bool
+	}{
+		{"{{ x }}", false, false},
+		{"{{ loop.index }}{{ loop.first }}{{ loop.depth0 }}", false, false},
+		{"{% if loop.last %}{% endif %}", true, false},
+		{"{{ loop.Last }}", true, false},
+		{"{{ loop.length }}", false, true},
+		{"{{ loop.revindex }}", false, true},
+		{"{{ loop.parent.index }}", false, true},
+		{"{{ f(loop) }}", false, true},
+		{`{{ loop["index"] }}`, false, true},
+		{`{% include "a" %}`, false, true},
+		{`{% include "a" only %}`, false, false},
+		{"{% block b %}{% endblock %}", false, true},
+		{"{% macro m() %}{{ loop.length }}{% endmacro %}", false, true},
+	}
+	for _, test := range tests {
+		tree := NewTree("test")
+		if err := tree.Parse("{% for x in xs %}" + test.tmpl + "{% endfor %}"); err != nil {
+			t.Fatalf("%s: %s", test.tmpl, err)
+		}
+		stmt := tree.Root[0].(*ForStmt)
+		if stmt.Lookahead != test.lookahead || stmt.Collect != test.collect {
+			t.Errorf("%s: expected lookahead %v and collect %v, got %v and %v",
+				test.tmpl, test.lookahead, test.collect, stmt.Lookahead, stmt.Collect)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package xt
+
+import (
+	"io"
+	"strings"
+)
+
+// ImportStmt imports the macros and variables defined at the top level of
+// another template, and assigns them to the variable Name as a map.
+// The imported template has access to the variables of the current
+// template only if WithContext is set.
+type ImportStmt struct {
+	Start       Pos
+	Template    Node // expression evaluating to the name of the imported template
+	Name        string
+	WithContext bool
+}
+
+// Position returns the start position of the statement
+func (s *ImportStmt) Position() Pos { return s.Start }
+
+// FromImportStmt imports some of the macros and variables defined at the top
+// level of another template, and assigns them to variables. Names are the
+// names in the imported template, and Aliases the names of the variables.
+type FromImportStmt struct {
+	Start       Pos
+	Template    Node // expression evaluating to the name of the imported template
+	Names       []string
+	Aliases     []string
+	WithContext bool
+}
+
+// Position returns the start position of the statement
+func (s *FromImportStmt) Position() Pos { return s.Start }
+
+// import statement:
+//  {% import expression as <name:identifier> [with context|without context] %}
+func (t *Tree) newImportStmt() (n Node, err error) {
+	start := t.items[0]
+	stmt := &ImportStmt{Start: start.pos}
+	stmt.Template, err = t.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := t.next(); !isWord(token, "as") {
+		return nil, t.errorf("expected 'as', got %s", token)
+	}
+	name := t.next()
+	if name.typ != itemIdentifier {
+		return nil, t.errorf("expected identifier, got %s", name)
+	}
+	stmt.Name = name.val
+
+	stmt.WithContext, err = t.importContext()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// from-import statement:
+//  {% from expression import <name:identifier> [as <alias:identifier>][, ...] [with context|without context] %}
+func (t *Tree) newFromImportStmt() (n Node, err error) {
+	start := t.items[0]
+	stmt := &FromImportStmt{Start: start.pos}
+	stmt.Template, err = t.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := t.next(); !isWord(token, "import") {
+		return nil, t.errorf("expected 'import', got %s", token)
+	}
+	for {
+		name := t.next()
+		if name.typ != itemIdentifier {
+			return nil, t.errorf("expected identifier, got %s", name)
+		}
+		alias := name
+		if isWord(t.peek(), "as") {
+			t.next()
+			alias = t.next()
+			if alias.typ != itemIdentifier {
+				return nil, t.errorf("expected identifier, got %s", alias)
+			}
+		}
+		stmt.Names = append(stmt.Names, name.val)
+		stmt.Aliases = append(stmt.Aliases, alias.val)
+
+		if !isChar(t.peek(), ",") {
+			break
+		}
+		t.next()
+	}
+
+	stmt.WithContext, err = t.importContext()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// importContext parses the end of an import statement, with an optional
+// 'with context' or 'without context', and reports whether the imported
+// template has access to the variables of the current template
+func (t *Tree) importContext() (withContext bool, err error) {
+	token := t.next()
+	if isWord(token, "with") || isWord(token, "without") {
+		withContext = token.val == "with"
+		if token = t.next(); !isWord(token, "context") {
+			return false, t.errorf("expected 'context', got %s", token)
+		}
+		token = t.next()
+	}
+	if token.typ != itemTagEnd {
+		return false, t.errorf("unexpected token in import statement: %s", token)
+	}
+	return withContext, nil
+}
+
+// walkImport executes an import statement
+func (s *state) walkImport(n *ImportStmt) error {
+	exports, err := s.importTemplate(n.Template, n.WithContext)
+	if err != nil {
+		return err
+	}
+	s.define(n.Name, exports)
+	return nil
+}
+
+// walkFromImport executes a from-import statement
+func (s *state) walkFromImport(n *FromImportStmt) error {
+	exports, err := s.importTemplate(n.Template, n.WithContext)
+	if err != nil {
+		return err
+	}
+	s.at(n)
+	for k, name := range n.Names {
+		val, ok := exports[name]
+		switch {
+		case strings.HasPrefix(name, "_"):
+			return s.errorf("cannot import '%s': names starting with '_' are private", name)
+		case !ok:
+			return s.errorf("cannot import '%s': not defined in the imported template", name)
+		}
+		s.define(n.Aliases[k], val)
+	}
+	return nil
+}
+
+// importTemplate loads and executes the template named by the expression
+// template, and returns the macros and variables defined at its top level.
+// Names starting with an underscore are private, and are not returned.
+func (s *state) importTemplate(template Node, withContext bool) (map[string]interface{}, error) {
+	val, err := s.evalExpr(template)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := toString(val)
+	if !ok {
+		return nil, s.errorf("template name must be a string, got %T", val)
+	}
+	tmpl, err := s.tree.env.GetTemplate(name)
+	if err != nil {
+		return nil, s.errorf("cannot import template: %s", err)
+	}
+	if s.depth >= maxDepth {
+		return nil, s.errorf("cannot import template '%s': maximum depth of %d exceeded", tmpl.name, maxDepth)
+	}
+
+	// the output of the imported template is discarded
+	sub := s.subState(tmpl, io.Discard, withContext)
+	if err = sub.executeTree(tmpl); err != nil {
+		return nil, err
+	}
+
+	exports := make(map[string]interface{}, len(sub.top))
+	for name, val := range sub.top {
+		if !strings.HasPrefix(name, "_") {
+			exports[name] = val
+		}
+	}
+	return exports, nil
+}
@@ -0,0 +1,42 @@
+package xt
+
+import "testing"
+
+func TestImportStmt(t *testing.T) {
+	env := newTestEnv(map[string]string{
+		"macros":  "output{% macro hello(n) %}hello {{ n }}{% endmacro %}{% set greeting = 'hi' %}{% set _secret = 1 %}",
+		"context": "{% set seen = x is defined %}{% macro show() %}{{ x }}{% endmacro %}",
+		"loop":    "{% set n = 0 %}{% for i in [1, 2, 3] %}{% set n = i %}{% endfor %}",
+		"broken":  "{% if %}",
+		"failing": "{% set x = 1 / 0 %}",
+		"self":    "{% import 'self' as s %}",
+	})
+	data := map[string]int{"x": 1}
+	runExecTests(t, env, []execTest{
+		{name: "import", tmpl: "{% import 'macros' as m %}{{ m.hello(1) }} {{ m.greeting }}", want: "hello 1 hi"},
+		{name: "output discarded", tmpl: "a{% import 'macros' as m %}b", want: "ab"},
+		{name: "private names", tmpl: "{% import 'macros' as m %}{{ m._secret is defined }}", want: "false"},
+		{name: "expression", tmpl: "{% import name as m %}{{ m.greeting }}", data: map[string]string{"name": "macros"}, want: "hi"},
+		{name: "from import", tmpl: "{% from 'macros' import hello, greeting %}{{ hello(2) }} {{ greeting }}", want: "hello 2 hi"},
+		{name: "aliases", tmpl: "{% from 'macros' import hello as h, greeting as g %}{{ h(3) }} {{ g }}", want: "hello 3 hi"},
+		{name: "in loop", tmpl: "{% for i in [1, 2] %}{% from 'macros' import hello %}{{ hello(i) }};{% endfor %}", want: "hello 1;hello 2;"},
+		{name: "scoped set", tmpl: "{% import 'loop' as l %}{{ l.n }} {{ l.i is defined }}", want: "0 false"},
+		{name: "without context", tmpl: "{% import 'context' as c %}{{ c.seen }}[{{ c.show() }}]", data: data, want: "false[]"},
+		{name: "explicitly without context", tmpl: "{% import 'context' as c without context %}{{ c.seen }}", data: data, want: "false"},
+		{name: "with context", tmpl: "{% import 'context' as c with context %}{{ c.seen }}[{{ c.show() }}]", data: data, want: "true[1]"},
+		{name: "with context variables", tmpl: "{% set x = 2 %}{% from 'context' import show with context %}{{ show() }}", want: "2"},
+
+		{name: "missing name", tmpl: "{% from 'macros' import nothing %}", err: "cannot import 'nothing': not defined in the imported template"},
+		{name: "private name", tmpl: "{% from 'macros' import _secret %}", err: "cannot import '_secret': names starting with '_' are private"},
+		{name: "missing", tmpl: "{% import 'missing' as m %}", err: "cannot import template"},
+		{name: "syntax error", tmpl: "{% import 'broken' as m %}", err: "cannot import template: broken:1:"},
+		{name: "runtime error", tmpl: "{% import 'failing' as m %}", err: "failing:1:12: division by zero"},
+		{name: "imports itself", tmpl: "{% import 'self' as s %}", err: "cannot import template 'self': maximum depth of 1000 exceeded"},
+		{name: "name not a string", tmpl: "{% import 1 as m %}", err: "template name must be a string, got int"},
+		{name: "missing as", tmpl: "{% import 'macros' m %}", err: "expected 'as'"},
+		{name: "missing alias", tmpl: "{% import 'macros' as %}", err: "expected identifier"},
+		{name: "missing import", tmpl: "{% from 'macros' hello %}", err: "expected 'import'"},
+		{name: "missing context", tmpl: "{% import 'macros' as m with %}", err: "expected 'context'"},
+		{name: "unexpected token", tmpl: "{% from 'macros' import hello x %}", err: "unexpected token in import statement"},
+	})
+}
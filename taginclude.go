@@ -0,0 +1,128 @@
+package xt
+
+import (
+	"errors"
+	"reflect"
+)
+
+// IncludeStmt defines an include of another template.
+// Template is evaluated to either a template name, or a list of template names
+// where the first existing template is included.
+// The included template has access to the variables of the current template,
+// unless Only is set. With is an optional expression evaluating to a map of
+// additional variables.
+type IncludeStmt struct {
+	Start         Pos
+	Template      Node
+	With          Node
+	Only          bool
+	IgnoreMissing bool
+}
+
+// Position returns the start position of the statement
+func (s *IncludeStmt) Position() Pos { return s.Start }
+
+// include statement:
+//  {% include expression [ignore missing] [with expression] [only] %}
+func (t *Tree) newIncludeStmt() (n Node, err error) {
+	start := t.items[0]
+	stmt := &IncludeStmt{Start: start.pos}
+	stmt.Template, err = t.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	token := t.next()
+	if isWord(token, "ignore") {
+		if token = t.next(); !isWord(token, "missing") {
+			return nil, t.errorf("expected 'missing', got %s", token)
+		}
+		stmt.IgnoreMissing = true
+		token = t.next()
+	}
+	if isWord(token, "with") {
+		stmt.With, err = t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		token = t.next()
+	}
+	if isWord(token, "only") {
+		stmt.Only = true
+		token = t.next()
+	}
+	if token.typ != itemTagEnd {
+		return nil, t.errorf("unexpected token in include statement: %s", token)
+	}
+	return stmt, nil
+}
+
+// walkInclude executes an included template
+func (s *state) walkInclude(n *IncludeStmt) error {
+	val, err := s.evalExpr(n.Template)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	if name, ok := toString(val); ok {
+		names = append(names, name)
+	} else if v := indirect(reflect.ValueOf(val)); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			name, ok := toString(v.Index(i).Interface())
+			if !ok {
+				return s.errorf("template name must be a string, got %s", v.Index(i).Type())
+			}
+			names = append(names, name)
+		}
+	} else {
+		return s.errorf("template name must be a string or a list of strings, got %T", val)
+	}
+
+	var tmpl *Tree
+	for _, name := range names {
+		tmpl, err = s.tree.env.GetTemplate(name)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrTemplateNotFound) {
+			return s.errorf("cannot include template: %s", err)
+		}
+	}
+	if tmpl == nil {
+		if n.IgnoreMissing {
+			return nil
+		}
+		return s.errorf("cannot include template: %s", err)
+	}
+	if s.depth >= maxDepth {
+		return s.errorf("cannot include template '%s': maximum depth of %d exceeded", tmpl.name, maxDepth)
+	}
+
+	sub := s.subState(tmpl, s.wr, !n.Only)
+
+	if n.With != nil {
+		with, err := s.evalExpr(n.With)
+		if err != nil {
+			return err
+		}
+		elements, err := iterate(with)
+		if err != nil || indirect(reflect.ValueOf(with)).Kind() != reflect.Map {
+			return s.errorf("include variables must be a map, got %T", with)
+		}
+		// the variables are part of the context, so they are shadowed
+		// by the variables defined by the included template
+		if sub.outer == nil {
+			sub.outer = make(map[string]interface{}, len(elements))
+		}
+		for _, element := range elements {
+			name, ok := toString(element[0])
+			if !ok {
+				return s.errorf("include variable names must be strings, got %T", element[0])
+			}
+			sub.outer[name] = element[1]
+		}
+	}
+
+	return sub.executeTree(tmpl)
+}
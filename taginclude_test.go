@@ -0,0 +1,49 @@
+package xt
+
+import "testing"
+
+func TestIncludeStmt(t *testing.T) {
+	env := newTestEnv(map[string]string{
+		"plain":  "plain",
+		"vars":   "{{ x }}{{ y }}",
+		"local":  "{% set z = 3 %}{{ z }}",
+		"shadow": "{% set x = 2 %}{{ x }}",
+		"nested": "<{% include 'vars' %}>",
+		"broken": "{% if %}",
+		"self":   "{% include 'self' %}",
+		"loop1":  "{% include 'loop2' %}",
+		"loop2":  "{% include 'loop1' %}",
+		"count":  "{% if n > 0 %}{{ n }}{% include 'count' with {'n': n - 1} %}{% endif %}",
+	})
+	data := map[string]int{"x": 1}
+	runExecTests(t, env, []execTest{
+		{name: "plain", tmpl: "a{% include 'plain' %}b", want: "aplainb"},
+		{name: "data", tmpl: "{% include 'vars' %}", data: data, want: "1"},
+		{name: "variables", tmpl: "{% set y = 2 %}{% include 'vars' %}", data: data, want: "12"},
+		{name: "loop variable", tmpl: "{% for y in [1, 2] %}{% include 'vars' %}{% endfor %}", want: "12"},
+		{name: "nested", tmpl: "{% set y = 2 %}{% include 'nested' %}", data: data, want: "<12>"},
+		{name: "expression", tmpl: "{% include name %}", data: map[string]string{"name": "plain"}, want: "plain"},
+		{name: "only", tmpl: "{% set y = 2 %}{% include 'vars' only %}", data: data, want: ""},
+		{name: "with", tmpl: "{% include 'vars' with {'y': 2} %}", data: data, want: "12"},
+		{name: "with only", tmpl: "{% set y = 2 %}{% include 'vars' with {'x': 3} only %}", data: data, want: "3"},
+		{name: "with shadows", tmpl: "{% set y = 2 %}{% include 'vars' with {'y': 3} %}", want: "3"},
+		{name: "with shadowed", tmpl: "{% include 'shadow' with {'x': 1} %}", want: "2"},
+		{name: "with only shadowed", tmpl: "{% include 'shadow' with {'x': 1} only %}", want: "2"},
+		{name: "recursion", tmpl: "{% include 'count' with {'n': 3} %}", want: "321"},
+		{name: "ignore missing", tmpl: "a{% include 'missing' ignore missing %}b", want: "ab"},
+		{name: "ignore missing with only", tmpl: "{% include 'missing' ignore missing with {} only %}", want: ""},
+		{name: "candidates", tmpl: "{% include ['missing', 'plain', 'vars'] %}", want: "plain"},
+		{name: "candidates missing", tmpl: "{% include ['missing', 'other'] ignore missing %}x", want: "x"},
+
+		{name: "missing", tmpl: "{% include 'missing' %}", err: "cannot include template"},
+		{name: "missing candidates", tmpl: "{% include ['missing', 'other'] %}", err: "cannot include template"},
+		{name: "syntax error", tmpl: "{% include 'broken' %}", err: "cannot include template: broken:1:"},
+		{name: "includes itself", tmpl: "{% include 'self' %}", err: "self:1:12: cannot include template 'self': maximum depth of 1000 exceeded"},
+		{name: "mutual includes", tmpl: "{% include 'loop1' %}", err: "maximum depth of 1000 exceeded"},
+		{name: "name not a string", tmpl: "{% include 1 %}", err: "template name must be a string or a list of strings, got int"},
+		{name: "candidate not a string", tmpl: "{% include ['plain', 1] %}", err: "template name must be a string, got interface {}"},
+		{name: "with not a map", tmpl: "{% include 'plain' with [1] %}", err: "include variables must be a map, got []interface {}"},
+		{name: "unexpected token", tmpl: "{% include 'plain' without %}", err: "unexpected token in include statement"},
+		{name: "ignore without missing", tmpl: "{% include 'plain' ignore %}", err: "expected 'missing'"},
+	})
+}
@@ -0,0 +1,303 @@
+package xt
+
+import (
+	"strings"
+)
+
+// MacroStmt defines a macro, which is called like a function and
+// returns its rendered body. The arguments are available as variables
+// in the body, along with 'varargs' and 'kwargs' holding any extra
+// positional and keyword arguments, and 'caller' if the macro is
+// called from a call block.
+type MacroStmt struct {
+	Start Pos
+	Name  string
+	Args  []string // names of the arguments
+	// Defaults are the default values of the last len(Defaults) arguments
+	Defaults []Node
+	Body     []Node
+
+	Autoescape bool // the body is autoescaped, so the output is returned as Markup
+	Varargs    bool // the body uses 'varargs', so extra positional arguments are accepted
+	Kwargs     bool // the body uses 'kwargs', so extra keyword arguments are accepted
+}
+
+// Position returns the start position of the statement
+func (s *MacroStmt) Position() Pos { return s.Start }
+
+// CallStmt calls a macro, which can call the body of the call block
+// with 'caller()'. The output of the macro is escaped as a variable.
+type CallStmt struct {
+	Start    Pos
+	Call     Node // the call of the macro, a *CallExpr
+	Caller   Node // the body of the call block, as a *MacroStmt named 'caller'
+	Escapers []string
+}
+
+// Position returns the start position of the statement
+func (s *CallStmt) Position() Pos { return s.Start }
+
+// macro is a macro defined while executing a template, together with
+// the variables visible where it was defined
+type macro struct {
+	stmt  *MacroStmt
+	tree  *Tree
+	data  interface{}
+	vars  []variable
+	top   map[string]interface{}
+	outer map[string]interface{}
+}
+
+// macro statement:
+//  {% macro <name:identifier>([<arg:identifier>[=expression], ...]) %}
+//  {% endmacro %}
+func (t *Tree) newMacroStmt() (n Node, err error) {
+	start := t.items[0]
+	name := t.next()
+	if name.typ != itemIdentifier {
+		return nil, t.errorf("expected macro name, got %s", name)
+	}
+	if token := t.next(); token.typ != itemLeftParen {
+		return nil, t.errorf("expected '(', got %s", token)
+	}
+
+	stmt := &MacroStmt{Start: start.pos, Name: name.val}
+	stmt.Args, stmt.Defaults, err = t.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	if token := t.next(); token.typ != itemTagEnd {
+		return nil, t.errorf("unexpected extra arguments to 'macro' statement: %s", token)
+	}
+
+	stmt.Body, err = t.macroBody(stmt, "endmacro")
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// call statement:
+//  {% call[(<arg:identifier>[=expression], ...)] <macro:expression>(arguments...) %}
+//  {% endcall %}
+func (t *Tree) newCallStmt() (n Node, err error) {
+	start := t.items[0]
+	caller := &MacroStmt{Start: start.pos, Name: "caller"}
+	if t.peek().typ == itemLeftParen {
+		t.next()
+		caller.Args, caller.Defaults, err = t.parseParams()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	call, err := t.expression(itemTagEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := call.(*CallExpr); !ok {
+		return nil, t.errorf("expected macro call in 'call' statement")
+	}
+
+	stmt := &CallStmt{
+		Start:  start.pos,
+		Call:   call,
+		Caller: caller,
+	}
+	if t.autoescape {
+		stmt.Escapers = t.ctx.escapers()
+	}
+
+	caller.Body, err = t.macroBody(caller, "endcall")
+	if err != nil {
+		return nil, err
+	}
+	t.ctx = t.ctx.afterVar()
+	return stmt, nil
+}
+
+// macroBody parses the body of the macro stmt, up to the end tag named end.
+// The body is parsed as if it starts in HTML text, since the output of the
+// macro can be used anywhere.
+func (t *Tree) macroBody(stmt *MacroStmt, end string) ([]Node, error) {
+	ctx, loopDepth := t.ctx, t.loopDepth
+	t.ctx, t.loopDepth = context{}, 0
+	body, endTag, err := t.itemList(end)
+	t.ctx, t.loopDepth = ctx, loopDepth
+	if err != nil {
+		return nil, err
+	}
+	if endTag.typ == itemEOF {
+		return nil, t.errorf("expected '%s'-tag, got end-of-file", end)
+	}
+	t.consumeUntil(itemTagEnd)
+
+	stmt.Autoescape = t.autoescape
+	stmt.Varargs = references(body, "varargs")
+	stmt.Kwargs = references(body, "kwargs")
+	return body, nil
+}
+
+// parseParams parses the parameters of a macro, after the opening '('
+// and up to and including the closing ')'. Parameters with default values
+// must follow the parameters without default values.
+//  name1, name2..., name3=expression, name4=expression...
+func (t *Tree) parseParams() (names []string, defaults []Node, err error) {
+	if t.peek().typ == itemRightParen {
+		t.next()
+		return nil, nil, nil
+	}
+	for {
+		name := t.next()
+		if name.typ != itemIdentifier {
+			return nil, nil, t.errorf("expected argument name, got %s", name)
+		}
+		for _, n := range names {
+			if n == name.val {
+				return nil, nil, t.errorf("duplicate argument '%s'", name.val)
+			}
+		}
+		names = append(names, name.val)
+
+		if t.peek().typ == itemAssign {
+			t.next()
+			def, err := t.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			defaults = append(defaults, def)
+		} else if len(defaults) > 0 {
+			return nil, nil, t.newError(SyntaxError, name.pos, "argument '%s' without default value follows argument with default value", name.val)
+		}
+
+		token := t.next()
+		if token.typ == itemRightParen {
+			return names, defaults, nil
+		}
+		if !isChar(token, ",") {
+			return nil, nil, t.errorf("expected ',' or ')', got %s", token)
+		}
+	}
+}
+
+// references reports whether the identifier name is used in any of the nodes,
+// including in nested statements and expressions
+func references(nodes []Node, name string) (found bool) {
+	inspect(nodes, func(n Node) bool {
+		if id, ok := n.(*Identifier); ok && id.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// defineMacro makes the macro n available as a variable. The macro sees
+// the variables visible where it is defined, including itself.
+func (s *state) defineMacro(n *MacroStmt) {
+	m := &macro{
+		stmt:  n,
+		tree:  s.tree,
+		data:  s.data,
+		top:   s.top,
+		outer: s.outer,
+	}
+	m.vars = append(s.vars[:len(s.vars):len(s.vars)], variable{n.Name, m})
+	s.define(n.Name, m)
+}
+
+// walkCall executes a call block
+func (s *state) walkCall(n *CallStmt) error {
+	caller := &macro{
+		stmt:  n.Caller.(*MacroStmt),
+		tree:  s.tree,
+		data:  s.data,
+		vars:  s.vars[:len(s.vars):len(s.vars)],
+		top:   s.top,
+		outer: s.outer,
+	}
+	val, err := s.evalCallWith(n.Call.(*CallExpr), caller)
+	if err != nil {
+		return err
+	}
+	return s.printValue(val, n.Escapers)
+}
+
+// callMacro executes the macro m with the positional arguments args, and
+// the keyword arguments kwargs named by names, and returns the rendered body.
+// If caller is set, it is available to the macro as 'caller'.
+func (s *state) callMacro(m *macro, args []interface{}, names []string, kwargs []interface{}, caller *macro) (interface{}, error) {
+	stmt := m.stmt
+	if len(args) > len(stmt.Args) && !stmt.Varargs {
+		return nil, s.errorf("macro '%s' takes at most %d arguments, got %d", stmt.Name, len(stmt.Args), len(args))
+	}
+	if s.depth >= maxDepth {
+		return nil, s.errorf("cannot call macro '%s': maximum depth of %d exceeded", stmt.Name, maxDepth)
+	}
+
+	extra := make(map[string]interface{})
+	for k, name := range names {
+		extra[name] = kwargs[k]
+	}
+
+	var sb strings.Builder
+	sub := &state{
+		tree:   m.tree,
+		wr:     &sb,
+		data:   m.data,
+		vars:   m.vars[:len(m.vars):len(m.vars)],
+		top:    m.top,
+		outer:  m.outer,
+		scopes: 1,
+		blocks: make(map[string][]blockDef),
+		depth:  s.depth + 1,
+	}
+	firstDefault := len(stmt.Args) - len(stmt.Defaults)
+	for k, name := range stmt.Args {
+		val, given := extra[name]
+		if given {
+			if k < len(args) {
+				return nil, s.errorf("macro '%s' got multiple values for argument '%s'", stmt.Name, name)
+			}
+			delete(extra, name)
+		} else if k < len(args) {
+			val = args[k]
+		} else if k >= firstDefault {
+			// default values can refer to the preceding arguments
+			var err error
+			val, err = sub.evalExpr(stmt.Defaults[k-firstDefault])
+			if err != nil {
+				return nil, err
+			}
+		}
+		sub.push(name, val)
+	}
+
+	if stmt.Varargs {
+		varargs := []interface{}{}
+		if len(args) > len(stmt.Args) {
+			varargs = args[len(stmt.Args):]
+		}
+		sub.push("varargs", varargs)
+	}
+	if stmt.Kwargs {
+		sub.push("kwargs", extra)
+	} else {
+		for _, name := range names {
+			if _, ok := extra[name]; ok {
+				return nil, s.errorf("macro '%s' got an unexpected keyword argument '%s'", stmt.Name, name)
+			}
+		}
+	}
+	if caller != nil {
+		sub.push("caller", caller)
+	}
+
+	if err := sub.walkList(stmt.Body); err != nil {
+		return nil, err
+	}
+	if stmt.Autoescape {
+		return Markup(sb.String()), nil
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,51 @@
+package xt
+
+import "testing"
+
+func TestMacroStmt(t *testing.T) {
+	env := newTestEnv(map[string]string{"rec": "{% macro m() %}{% include 'rec' %}{% endmacro %}{{ m() }}"})
+	data := map[string]int{"x": 1}
+	runExecTests(t, env, []execTest{
+		{name: "macro", tmpl: "{% macro m(a, b) %}{{ a }}-{{ b }}{% endmacro %}{{ m(1, 2) }}", want: "1-2"},
+		{name: "no output", tmpl: "a{% macro m() %}m{% endmacro %}b", want: "ab"},
+		{name: "called twice", tmpl: "{% macro m(a) %}<{{ a }}>{% endmacro %}{{ m(1) }}{{ m(2) }}", want: "<1><2>"},
+		{name: "missing argument", tmpl: "{% macro m(a, b) %}{{ a }}{{ b is none }}{% endmacro %}{{ m(1) }}", want: "1true"},
+		{name: "defaults", tmpl: "{% macro m(a, b=2, c=a + 1) %}{{ a }}{{ b }}{{ c }}{% endmacro %}{{ m(1) }} {{ m(1, 3) }} {{ m(1, c=5) }}", want: "122 132 125"},
+		{name: "keyword arguments", tmpl: "{% macro m(a, b) %}{{ a }}{{ b }}{% endmacro %}{{ m(b=2, a=1) }}", want: "12"},
+		{name: "varargs", tmpl: "{% macro m(a) %}{{ a }}{{ varargs }}{% endmacro %}{{ m(1, 2, 3) }}{{ m(1) }}", want: "1[2 3]1[]"},
+		{name: "kwargs", tmpl: "{% macro m(a) %}{{ a }}{{ kwargs.b }}{% endmacro %}{{ m(1, b=2) }}", want: "12"},
+		{name: "data", tmpl: "{% macro m() %}{{ x }}{% endmacro %}{{ m() }}", data: data, want: "1"},
+		{name: "top level variables", tmpl: "{% macro m() %}{{ y }}{% endmacro %}{% set y = 2 %}{{ m() }}", want: "2"},
+		{name: "argument shadows", tmpl: "{% macro m(x) %}{{ x }}{% endmacro %}{{ m(2) }}{{ x }}", data: data, want: "21"},
+		{name: "local set", tmpl: "{% macro m() %}{% set y = 2 %}{{ y }}{% endmacro %}{% set y = 1 %}{{ m() }}{{ y }}", want: "21"},
+		{name: "loop variable", tmpl: "{% for i in [1, 2] %}{% macro m() %}{{ i }}{% endmacro %}{{ m() }}{% endfor %}", want: "12"},
+		{name: "macro calling macro", tmpl: "{% macro a() %}a{% endmacro %}{% macro b() %}[{{ a() }}]{% endmacro %}{{ b() }}", want: "[a]"},
+		{name: "recursion", tmpl: "{% macro m(n) %}{{ n }}{% if n > 0 %}{{ m(n - 1) }}{% endif %}{% endmacro %}{{ m(3) }}", want: "3210"},
+		{name: "whitespace", tmpl: "{% macro m() -%}\n  a\n{%- endmacro %}[{{ m() }}]", want: "[a]"},
+
+		{name: "call", tmpl: "{% macro m() %}<{{ caller() }}>{% endmacro %}{% call m() %}body{% endcall %}", want: "<body>"},
+		{name: "call with arguments", tmpl: "{% macro m(a) %}{{ a }}:{{ caller() }}{% endmacro %}{% call m(1) %}b{% endcall %}", want: "1:b"},
+		{name: "caller arguments", tmpl: "{% macro list(items) %}{% for i in items %}{{ caller(i) }}{% endfor %}{% endmacro %}{% call(item) list([1, 2]) %}<{{ item }}>{% endcall %}", want: "<1><2>"},
+		{name: "caller defaults", tmpl: "{% macro m() %}{{ caller() }}{{ caller(2) }}{% endmacro %}{% call(a=1) m() %}{{ a }}{% endcall %}", want: "12"},
+		{name: "caller sees variables", tmpl: "{% macro m() %}{{ caller() }}{% endmacro %}{% set y = 3 %}{% call m() %}{{ y }}{{ x }}{% endcall %}", data: data, want: "31"},
+		{name: "caller called twice", tmpl: "{% macro m() %}{{ caller() }}{{ caller() }}{% endmacro %}{% call m() %}c{% endcall %}", want: "cc"},
+		{name: "caller defined", tmpl: "{% macro m() %}{{ caller is defined }}{% endmacro %}{{ m() }}", want: "false"},
+
+		{name: "too many arguments", tmpl: "{% macro m(a) %}{% endmacro %}{{ m(1, 2) }}", err: "macro 'm' takes at most 1 arguments, got 2"},
+		{name: "multiple values", tmpl: "{% macro m(a) %}{% endmacro %}{{ m(1, a=2) }}", err: "macro 'm' got multiple values for argument 'a'"},
+		{name: "unexpected keyword", tmpl: "{% macro m(a) %}{% endmacro %}{{ m(b=2) }}", err: "macro 'm' got an unexpected keyword argument 'b'"},
+		{name: "duplicate argument", tmpl: "{% macro m(a, a) %}{% endmacro %}", err: "duplicate argument 'a'"},
+		{name: "default order", tmpl: "{% macro m(a=1, b) %}{% endmacro %}", err: "argument 'b' without default value follows argument with default value"},
+		{name: "missing name", tmpl: "{% macro (a) %}{% endmacro %}", err: "expected macro name"},
+		{name: "missing parenthesis", tmpl: "{% macro m %}{% endmacro %}", err: "expected '('"},
+		{name: "extra arguments", tmpl: "{% macro m() x %}{% endmacro %}", err: "unexpected extra arguments to 'macro' statement"},
+		{name: "missing endmacro", tmpl: "{% macro m() %}", err: "expected 'endmacro'-tag, got end-of-file"},
+		{name: "call without call", tmpl: "{% call m %}{% endcall %}", err: "expected macro call in 'call' statement"},
+		{name: "missing endcall", tmpl: "{% macro m() %}{% endmacro %}{% call m() %}", err: "expected 'endcall'-tag, got end-of-file"},
+		{name: "infinite recursion", tmpl: "{% macro m() %}{{ m() }}{% endmacro %}{{ m() }}", err: "infinite recursion:1:19: cannot call macro 'm': maximum depth of 1000 exceeded"},
+		{name: "mutual recursion", tmpl: "{% macro a() %}{{ b() }}{% endmacro %}{% macro b() %}{{ a() }}{% endmacro %}{{ a() }}", err: "maximum depth of 1000 exceeded"},
+		{name: "caller recursion", tmpl: "{% macro m() %}{% call m() %}{% endcall %}{% endmacro %}{{ m() }}", err: "cannot call macro 'm': maximum depth of 1000 exceeded"},
+		{name: "include recursion", tmpl: "{% include 'rec' %}", err: "maximum depth of 1000 exceeded"},
+		{name: "error in macro", tmpl: "{% macro m() %}{{ 1 / 0 }}{% endmacro %}{{ m() }}", err: "error in macro:1:19: division by zero"},
+	})
+}
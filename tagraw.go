@@ -0,0 +1,31 @@
+package xt
+
+// raw statement:
+//  {% raw %}...{% endraw %}
+// The text between the tags is not tokenized by the lexer, and is returned
+// as a single TextValue.
+func (t *Tree) newRawStmt() (n Node, err error) {
+	start := t.items[0]
+	if token := t.next(); token.typ != itemTagEnd {
+		return nil, t.errorf("unexpected extra arguments to 'raw' statement: %s", token)
+	}
+
+	text := &TextValue{Start: start.pos}
+	token := t.next()
+	if token.typ == itemText {
+		text.Start, text.Text = token.pos, token.val
+		t.ctx = t.ctx.advance(token.val)
+		token = t.next()
+	}
+	if token.typ == itemError {
+		return nil, t.errorf("%s", token.val)
+	}
+	if token.typ != itemTagStart {
+		return nil, t.errorf("expected 'endraw'-tag, got %s", token)
+	}
+	if token = t.next(); token.val != "endraw" {
+		return nil, t.errorf("expected 'endraw'-tag, got %s", token)
+	}
+	t.consumeUntil(itemTagEnd)
+	return text, nil
+}
@@ -0,0 +1,28 @@
+package xt
+
+import "testing"
+
+func TestRawStmt(t *testing.T) {
+	env := NewEnvironment()
+	runExecTests(t, env, []execTest{
+		{name: "raw", tmpl: "a{% raw %}{{ x }}{% if %}{# c #}{% endraw %}b", want: "a{{ x }}{% if %}{# c #}b"},
+		{name: "empty", tmpl: "a{% raw %}{% endraw %}b", want: "ab"},
+		{name: "multi-line", tmpl: "{% raw %}\n{{ x }}\n{% endraw %}", want: "\n{{ x }}\n"},
+		{name: "unterminated tags", tmpl: "{% raw %}{{ x {% endraw %}", want: "{{ x "},
+		{name: "endraw in string", tmpl: "{% raw %}'{% endraw %}'", want: "''"},
+		{name: "trim markers", tmpl: "a {%- raw -%} {{ x }} {%- endraw -%} b", want: "a{{ x }}b"},
+		{name: "in loop", tmpl: "{% for i in [1, 2] %}{% raw %}{{ i }}{% endraw %}{% endfor %}", want: "{{ i }}{{ i }}"},
+		{name: "variable after", tmpl: "{% raw %}{{{% endraw %}{{ 1 }}", want: "{{1"},
+
+		{name: "arguments", tmpl: "{% raw x %}{% endraw %}", err: "unexpected extra arguments to 'raw' statement"},
+		{name: "unterminated", tmpl: "{% raw %}{{ x }}", err: "unterminated:1:"},
+		{name: "endraw arguments", tmpl: "{% raw %}a{% endraw x %}b", err: "endraw arguments:1:"},
+	})
+
+	env = NewEnvironment()
+	env.SetAutoescape(AutoescapeExtensions())
+	runExecTests(t, env, []execTest{
+		{name: "context.html", tmpl: "<a href=\"{% raw %}/x{% endraw %}{{ u }}\">", data: map[string]string{"u": "javascript:x"}, want: "<a href=\"/xjavascript:x\">"},
+		{name: "not escaped.html", tmpl: "{% raw %}<b>{% endraw %}", want: "<b>"},
+	})
+}
@@ -0,0 +1,187 @@
+package xt
+
+import (
+	"strings"
+)
+
+// SetStmt assigns the value of Expression to the variables in Names.
+// If there is more than one variable, the value is unpacked.
+// If Expression is nil, the rendered Body is assigned to the single
+// variable in Names instead.
+type SetStmt struct {
+	Start      Pos
+	Names      []string
+	Expression Node
+	Body       []Node
+	Autoescape bool // the body is autoescaped, so the output is assigned as Markup
+}
+
+// Position returns the start position of the statement
+func (s *SetStmt) Position() Pos { return s.Start }
+
+// WithStmt defines a new scope, where the values of the expressions in
+// Values are assigned to the variables in Names. The values are evaluated
+// before any of them are assigned.
+type WithStmt struct {
+	Start  Pos
+	Names  []string
+	Values []Node
+	Body   []Node
+}
+
+// Position returns the start position of the statement
+func (s *WithStmt) Position() Pos { return s.Start }
+
+// set statement:
+//  {% set <var:identifier>[, <var:identifier>...] = expression %}
+// or
+//  {% set <var:identifier> %}
+//  {% endset %}
+func (t *Tree) newSetStmt() (n Node, err error) {
+	start := t.items[0]
+	stmt := &SetStmt{Start: start.pos}
+	var token item
+	for {
+		token = t.next()
+		if token.typ != itemIdentifier {
+			return nil, t.errorf("expected identifier, got %s", token)
+		}
+		stmt.Names = append(stmt.Names, token.val)
+
+		token = t.next()
+		if !isChar(token, ",") {
+			break
+		}
+	}
+
+	switch {
+	case token.typ == itemAssign:
+		stmt.Expression, err = t.expression(itemTagEnd)
+		if err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	case token.typ != itemTagEnd:
+		return nil, t.errorf("expected '=', got %s", token)
+	case len(stmt.Names) > 1:
+		return nil, t.errorf("cannot assign a block to more than one variable")
+	}
+
+	// the captured output can be used anywhere, so the body
+	// is parsed as if it starts in HTML text
+	ctx, loopDepth := t.ctx, t.loopDepth
+	t.ctx, t.loopDepth = context{}, 0
+	body, end, err := t.itemList("endset")
+	t.ctx, t.loopDepth = ctx, loopDepth
+	if err != nil {
+		return nil, err
+	}
+	if end.typ == itemEOF {
+		return nil, t.errorf("expected 'endset'-tag, got end-of-file")
+	}
+	t.consumeUntil(itemTagEnd)
+
+	stmt.Body = body
+	stmt.Autoescape = t.autoescape
+	return stmt, nil
+}
+
+// with statement:
+//  {% with [<var:identifier> = expression[, <var:identifier> = expression...]] %}
+//  {% endwith %}
+func (t *Tree) newWithStmt() (n Node, err error) {
+	start := t.items[0]
+	stmt := &WithStmt{Start: start.pos}
+	for token := t.next(); token.typ != itemTagEnd; token = t.next() {
+		if len(stmt.Names) > 0 {
+			if !isChar(token, ",") {
+				return nil, t.errorf("expected ',', got %s", token)
+			}
+			token = t.next()
+		}
+		if token.typ != itemIdentifier {
+			return nil, t.errorf("expected identifier, got %s", token)
+		}
+		if next := t.next(); next.typ != itemAssign {
+			return nil, t.errorf("expected '=', got %s", next)
+		}
+		value, err := t.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Names = append(stmt.Names, token.val)
+		stmt.Values = append(stmt.Values, value)
+	}
+
+	body, end, err := t.itemList("endwith")
+	if err != nil {
+		return nil, err
+	}
+	if end.typ == itemEOF {
+		return nil, t.errorf("expected 'endwith'-tag, got end-of-file")
+	}
+	t.consumeUntil(itemTagEnd)
+
+	stmt.Body = body
+	return stmt, nil
+}
+
+// walkSet executes a set statement
+func (s *state) walkSet(n *SetStmt) error {
+	var val interface{}
+	if n.Expression != nil {
+		var err error
+		val, err = s.evalExpr(n.Expression)
+		if err != nil {
+			return err
+		}
+	} else {
+		var sb strings.Builder
+		wr, mark := s.wr, s.mark()
+		s.wr = &sb
+		s.scopes++
+		err := s.walkList(n.Body)
+		s.wr = wr
+		s.scopes--
+		s.pop(mark)
+		if err != nil {
+			return err
+		}
+		val = sb.String()
+		if n.Autoescape {
+			val = Markup(sb.String())
+		}
+	}
+
+	if len(n.Names) == 1 {
+		s.define(n.Names[0], val)
+		return nil
+	}
+	s.at(n)
+	values, err := unpack(val, len(n.Names))
+	if err != nil {
+		return s.errorf("%s", err)
+	}
+	for k, name := range n.Names {
+		s.define(name, values[k])
+	}
+	return nil
+}
+
+// walkWith executes a with statement
+func (s *state) walkWith(n *WithStmt) error {
+	values, err := s.evalArgs(n.Values)
+	if err != nil {
+		return err
+	}
+
+	mark := s.mark()
+	s.scopes++
+	for k, name := range n.Names {
+		s.push(name, values[k])
+	}
+	err = s.walkList(n.Body)
+	s.scopes--
+	s.pop(mark)
+	return err
+}
@@ -0,0 +1,55 @@
+package xt
+
+import "testing"
+
+func TestSetStmt(t *testing.T) {
+	env := newTestEnv(map[string]string{
+		"show":    "{{ x }}",
+		"shadow":  "{% set x = 2 %}{{ x }}",
+		"define":  "{% set y = 3 %}",
+		"nested":  "{% set x = 3 %}{% include 'show' %}",
+		"base":    "{% block b %}{% endblock %}{{ x is defined }}",
+		"imports": "{% set x = 2 %}{% macro show() %}{{ x }}{% endmacro %}",
+	})
+	data := map[string]int{"x": 1}
+	runExecTests(t, env, []execTest{
+		{name: "set", tmpl: "{% set y = 2 %}{{ y }}", want: "2"},
+		{name: "expression", tmpl: "{% set y = x + 1 %}{{ y }}", data: data, want: "2"},
+		{name: "shadows data", tmpl: "{{ x }}{% set x = 2 %}{{ x }}", data: data, want: "12"},
+		{name: "reassign", tmpl: "{% set y = 1 %}{% set y = y + 1 %}{{ y }}", want: "2"},
+		{name: "unpack", tmpl: "{% set a, b = [1, 2] %}{{ a }}{{ b }}", want: "12"},
+		{name: "block set", tmpl: "{% set y %}a{{ x }}b{% endset %}[{{ y }}]", data: data, want: "[a1b]"},
+		{name: "block set output", tmpl: "a{% set y %}b{% endset %}c", want: "ac"},
+		{name: "block set scope", tmpl: "{% set y %}{% set z = 1 %}{{ z }}{% endset %}{{ y }}{{ z is defined }}", want: "1false"},
+
+		{name: "loop body", tmpl: "{% set y = 0 %}{% for i in [1, 2] %}{% set y = i %}{{ y }}{% endfor %}{{ y }}", want: "120"},
+		{name: "loop body new variable", tmpl: "{% for i in [1, 2] %}{% set y = i %}{% endfor %}{{ y is defined }}", want: "false"},
+		{name: "loop body each iteration", tmpl: "{% for i in [1, 2] %}{{ y is defined }}{% set y = i %}{% endfor %}", want: "falsefalse"},
+		{name: "block", tmpl: "{% set y = 1 %}{% block b %}{% set y = 2 %}{{ y }}{% endblock %}{{ y }}", want: "21"},
+		{name: "block sees top", tmpl: "{% set y = 1 %}{% block b %}{{ y }}{% endblock %}", want: "1"},
+		{name: "block in base", tmpl: "{% extends 'base' %}{% block b %}{% set x = 1 %}{% endblock %}", want: "false"},
+		{name: "include sees set", tmpl: "{% set x = 1 %}{% include 'show' %}", want: "1"},
+		{name: "include shadows", tmpl: "{% set x = 1 %}{% include 'shadow' %}{{ x }}", want: "21"},
+		{name: "include shadows data", tmpl: "{% include 'shadow' %}{{ x }}", data: data, want: "21"},
+		{name: "include shadows loop variable", tmpl: "{% for x in [1] %}{% include 'shadow' %}{{ x }}{% endfor %}", want: "21"},
+		{name: "include shadows in nested include", tmpl: "{% set x = 1 %}{% include 'nested' %}{{ x }}", want: "31"},
+		{name: "include does not leak", tmpl: "{% include 'define' %}{{ y is defined }}", want: "false"},
+		{name: "import with context shadows", tmpl: "{% set x = 1 %}{% import 'imports' as m with context %}{{ m.x }}{{ m.show() }}{{ x }}", want: "221"},
+		{name: "import with context exports", tmpl: "{% set y = 1 %}{% import 'imports' as m with context %}{{ m.y is defined }}", want: "false"},
+
+		{name: "with", tmpl: "{% with a = 1, b = 2 %}{{ a }}{{ b }}{% endwith %}{{ a is defined }}", want: "12false"},
+		{name: "with empty", tmpl: "{% with %}{% set y = 1 %}{{ y }}{% endwith %}{{ y is defined }}", want: "1false"},
+		{name: "with evaluated first", tmpl: "{% with x = 2, y = x %}{{ x }}{{ y }}{% endwith %}", data: data, want: "21"},
+		{name: "with shadows", tmpl: "{% with x = 2 %}{{ x }}{% endwith %}{{ x }}", data: data, want: "21"},
+
+		{name: "unpack count", tmpl: "{% set a, b = [1, 2, 3] %}", err: "cannot unpack 3 values into 2 variables"},
+		{name: "unpack type", tmpl: "{% set a, b = 1 %}", err: "cannot unpack int64 into 2 variables"},
+		{name: "missing identifier", tmpl: "{% set = 1 %}", err: "expected identifier"},
+		{name: "missing assign", tmpl: "{% set a 1 %}", err: "expected '='"},
+		{name: "block set to several", tmpl: "{% set a, b %}{% endset %}", err: "cannot assign a block to more than one variable"},
+		{name: "missing endset", tmpl: "{% set a %}", err: "expected 'endset'-tag, got end-of-file"},
+		{name: "with missing assign", tmpl: "{% with a %}{% endwith %}", err: "expected '='"},
+		{name: "with missing comma", tmpl: "{% with a = 1 b = 2 %}{% endwith %}", err: "expected ','"},
+		{name: "missing endwith", tmpl: "{% with a = 1 %}", err: "expected 'endwith'-tag, got end-of-file"},
+	})
+}
@@ -0,0 +1,35 @@
+package xt
+
+// VarStmt defines a variable output statement.
+// The result of evaluating Expression is written to the output, escaped by
+// the escapers in Escapers unless the result is Markup. If autoescaping is
+// enabled, the escapers are chosen from where in the HTML document the
+// statement is, e.g. in a text, an attribute value or a script.
+type VarStmt struct {
+	Start      Pos
+	Expression Node
+	Escapers   []string
+}
+
+// Position returns the start position of the statement
+func (s *VarStmt) Position() Pos { return s.Start }
+
+// variable statement:
+//  {{ expression }}
+func (t *Tree) newVarStmt() (n Node, err error) {
+	start := t.items[0]
+	expression, err := t.expression(itemVarEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &VarStmt{
+		Start:      start.pos,
+		Expression: expression,
+	}
+	if t.autoescape {
+		stmt.Escapers = t.ctx.escapers()
+	}
+	t.ctx = t.ctx.afterVar()
+	return stmt, nil
+}
@@ -0,0 +1,30 @@
+package xt
+
+import "testing"
+
+func TestVarStmt(t *testing.T) {
+	data := map[string]interface{}{
+		"name":  "world",
+		"n":     42,
+		"f":     1.5,
+		"ok":    true,
+		"nil":   nil,
+		"items": []string{"a", "b"},
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "identifier", tmpl: "hello, {{ name }}!", data: data, want: "hello, world!"},
+		{name: "no spaces", tmpl: "{{name}}", data: data, want: "world"},
+		{name: "integer", tmpl: "{{ n }}", data: data, want: "42"},
+		{name: "float", tmpl: "{{ f }}", data: data, want: "1.5"},
+		{name: "bool", tmpl: "{{ ok }}", data: data, want: "true"},
+		{name: "nil", tmpl: "[{{ nil }}]", data: data, want: "[]"},
+		{name: "undefined", tmpl: "[{{ missing }}]", data: data, want: "[]"},
+		{name: "string literal", tmpl: `{{ "a" }}{{ 'b' }}`, want: "ab"},
+		{name: "slice", tmpl: "{{ items }}", data: data, want: "[a b]"},
+		{name: "in if", tmpl: "{% if ok %}{{ name }}{% else %}-{% endif %}", data: data, want: "world"},
+		{name: "in block", tmpl: "{% block b %}{{ name }}{% endblock %}", data: data, want: "world"},
+		{name: "no HTML escaping", tmpl: "{{ s }}", data: map[string]string{"s": "<b>"}, want: "<b>"},
+		{name: "empty", tmpl: "{{ }}", err: "1:4"},
+		{name: "unclosed", tmpl: "{{ name", err: "unclosed action"},
+	})
+}
@@ -0,0 +1,211 @@
+package xt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// TestFunc is a function used to test a value in a template,
+// e.g. '{% if n is divisibleby(3) %}'. value is the value being tested,
+// and args contains the arguments given to the test, if any.
+type TestFunc func(value interface{}, args ...interface{}) (bool, error)
+
+// builtinTests are the tests available in every environment.
+// The tests 'defined' and 'undefined' are handled by the executor,
+// since they need to know whether the tested expression exists.
+var builtinTests = map[string]TestFunc{
+	"boolean":     testBoolean,
+	"divisibleby": testDivisibleBy,
+	"even":        testEven,
+	"float":       testFloat,
+	"integer":     testInteger,
+	"iterable":    testIterable,
+	"lower":       testLower,
+	"mapping":     testMapping,
+	"none":        testNone,
+	"number":      testNumber,
+	"odd":         testOdd,
+	"sameas":      testSameAs,
+	"sequence":    testSequence,
+	"string":      testString,
+	"upper":       testUpper,
+}
+
+// applyTest applies the test fn to value. If fn panics, the panic is
+// recovered and returned as an error.
+func applyTest(fn TestFunc, value interface{}, args []interface{}) (res bool, err error) {
+	defer recoverPanic(&err)
+	return fn(value, args...)
+}
+
+// testNone checks if a value is nil
+func testNone(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	return !indirect(reflect.ValueOf(value)).IsValid(), nil
+}
+
+// testBoolean checks if a value is a boolean
+func testBoolean(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	return indirect(reflect.ValueOf(value)).Kind() == reflect.Bool, nil
+}
+
+// testNumber checks if a value is a number
+func testNumber(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	_, _, _, ok := toNumber(value)
+	return ok, nil
+}
+
+// testInteger checks if a value is an integer
+func testInteger(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	_, _, isInt, ok := toNumber(value)
+	return ok && isInt, nil
+}
+
+// testFloat checks if a value is a floating point number
+func testFloat(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	_, _, isInt, ok := toNumber(value)
+	return ok && !isInt, nil
+}
+
+// testString checks if a value is a string
+func testString(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	_, ok := toString(value)
+	return ok, nil
+}
+
+// testMapping checks if a value is a map
+func testMapping(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	return indirect(reflect.ValueOf(value)).Kind() == reflect.Map, nil
+}
+
+// testSequence checks if a value is a slice, an array or a string
+func testSequence(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	switch indirect(reflect.ValueOf(value)).Kind() {
+	case reflect.Slice, reflect.Array, reflect.String:
+		return true, nil
+	}
+	return false, nil
+}
+
+// testIterable checks if a value can be iterated over in a for-loop
+func testIterable(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	v := indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.String, reflect.Map, reflect.Chan:
+		return true, nil
+	case reflect.Func:
+		return v.Type().CanSeq() || v.Type().CanSeq2(), nil
+	}
+	return false, nil
+}
+
+// testEven checks if a value is an even integer
+func testEven(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	i, _, isInt, ok := toNumber(value)
+	if !ok || !isInt {
+		return false, fmt.Errorf("expected integer, got %T", value)
+	}
+	return i%2 == 0, nil
+}
+
+// testOdd checks if a value is an odd integer
+func testOdd(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	i, _, isInt, ok := toNumber(value)
+	if !ok || !isInt {
+		return false, fmt.Errorf("expected integer, got %T", value)
+	}
+	return i%2 != 0, nil
+}
+
+// testDivisibleBy checks if a value is divisible by n
+//  value is divisibleby(n)
+func testDivisibleBy(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return false, err
+	}
+	i, _, isInt, ok := toNumber(value)
+	if !ok || !isInt {
+		return false, fmt.Errorf("expected integer, got %T", value)
+	}
+	n, err := intArg(args, 0, 0)
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, fmt.Errorf("division by zero")
+	}
+	return i%int64(n) == 0, nil
+}
+
+// testLower checks if a string is all lowercase
+func testLower(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	s, ok := toString(value)
+	return ok && strings.IndexFunc(s, unicode.IsUpper) < 0, nil
+}
+
+// testUpper checks if a string is all uppercase
+func testUpper(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 0, 0); err != nil {
+		return false, err
+	}
+	s, ok := toString(value)
+	return ok && strings.IndexFunc(s, unicode.IsLower) < 0, nil
+}
+
+// testSameAs checks if a value is the same object as another value,
+// i.e. the same pointer, or the same value for non-pointer types
+//  value is sameas(other)
+func testSameAs(value interface{}, args ...interface{}) (bool, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return false, err
+	}
+	a, b := reflect.ValueOf(value), reflect.ValueOf(args[0])
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && !b.IsValid(), nil
+	}
+	if a.Type() != b.Type() {
+		return false, nil
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer(), nil
+	}
+	return a.Type().Comparable() && a.Interface() == b.Interface(), nil
+}
@@ -0,0 +1,50 @@
+package xt
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Token is a single token of a template, as seen by the parser
+type Token struct {
+	Type  string `json:"type"`  // type of the token, e.g. "text", "identifier" or "var-start"
+	Pos   Pos    `json:"pos"`   // byte position of the start of the token
+	Line  int    `json:"line"`  // line of the start of the token, starting at 1
+	Col   int    `json:"col"`   // column of the start of the token in runes, starting at 1
+	Value string `json:"value"` // text of the token, or the error message for tokens of type "error"
+}
+
+// Tokens returns the tokens of the template input, using the delimiters of the
+// environment. It is intended for debugging, e.g. to see why a template is parsed
+// the way it is. The last token has the type "EOF", or "error" if the input
+// could not be tokenized.
+func (e *Environment) Tokens(name, input string) []Token {
+	var tokens []Token
+	l := lex(name, input, e.lexOptions())
+	for it := range l.items {
+		tokens = append(tokens, Token{
+			Type:  it.typ.String(),
+			Pos:   it.pos,
+			Line:  it.line,
+			Col:   it.col,
+			Value: it.val,
+		})
+	}
+	return tokens
+}
+
+// Tokens returns the tokens of the template input, using the default environment
+func Tokens(name, input string) []Token {
+	return defaultEnvironment.Tokens(name, input)
+}
+
+// location returns the line and column of the byte position pos in input
+func location(input string, pos Pos) (line, col int) {
+	if int(pos) > len(input) {
+		pos = Pos(len(input))
+	}
+	text := input[:pos]
+	line = 1 + strings.Count(text, "\n")
+	col = 1 + utf8.RuneCountInString(text[strings.LastIndexByte(text, '\n')+1:])
+	return line, col
+}
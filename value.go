@@ -0,0 +1,795 @@
+package xt
+
+import (
+	"fmt"
+	"go/token"
+	"iter"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errorType is the reflect.Type of the error interface
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// kwargsType is the reflect.Type of Kwargs
+var kwargsType = reflect.TypeOf(Kwargs(nil))
+
+// Kwargs holds the keyword arguments of a function call, e.g. 'id' in
+// '{{ url_for("user", id=u.ID) }}'. A function registered with AddFunction
+// accepts keyword arguments if its last parameter has the type Kwargs.
+type Kwargs map[string]interface{}
+
+// getAttr returns the attribute name of val.
+// For structs, this is the exported field or method with that name. If no
+// such field or method exists, the name with an uppercase first letter is
+// tried as well, so that 'user.name' finds the field 'Name'.
+// Methods must not take any arguments, and return either a single value or
+// a value and an error. Methods taking arguments are called with a call
+// expression instead, e.g. 'user.Greet("Hello")', see getMethod.
+// For all other types, the attribute is looked up as if it was an index,
+// so that 'items.0' is the same as 'items[0]' and 'map.key' the same as 'map["key"]'.
+// Unknown attributes evaluate to nil.
+func getAttr(val interface{}, name string) (interface{}, error) {
+	res, _, err := lookupAttr(val, name)
+	return res, err
+}
+
+// lookupAttr works as getAttr, but also reports whether the attribute exists
+func lookupAttr(val interface{}, name string) (interface{}, bool, error) {
+	if val == nil || name == "" {
+		return nil, false, nil
+	}
+
+	for _, n := range []string{name, strings.ToUpper(name[:1]) + name[1:]} {
+		if res, ok, err := getField(reflect.ValueOf(val), n); ok || err != nil {
+			return res, ok, err
+		}
+	}
+
+	v := indirect(reflect.ValueOf(val))
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, false, nil
+		}
+		return lookupItem(val, i)
+	case reflect.Map:
+		if i, err := strconv.Atoi(name); err == nil && v.Type().Key().Kind() != reflect.String {
+			return lookupItem(val, i)
+		}
+		return lookupItem(val, name)
+	}
+	return nil, false, nil
+}
+
+// getField returns the exported method or struct field called name.
+// ok is false if v has no such method or field
+func getField(v reflect.Value, name string) (res interface{}, ok bool, err error) {
+	if !token.IsExported(name) {
+		return nil, false, nil
+	}
+
+	for {
+		if m := v.MethodByName(name); m.IsValid() {
+			res, err = callMethod(m, name)
+			return res, true, err
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface || v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, false, nil
+	}
+	f, ok := v.Type().FieldByName(name)
+	if !ok || !f.IsExported() {
+		return nil, false, nil
+	}
+	fv, err := v.FieldByIndexErr(f.Index)
+	if err != nil {
+		// embedded nil pointer
+		return nil, true, nil
+	}
+	return fv.Interface(), true, nil
+}
+
+// getMethod returns the exported method called name of val, bound to val,
+// without calling it. As for getAttr, the name with an uppercase first letter
+// is tried as well. ok is false if val has no such method.
+func getMethod(val interface{}, name string) (res interface{}, ok bool) {
+	if val == nil || name == "" {
+		return nil, false
+	}
+	for _, n := range []string{name, strings.ToUpper(name[:1]) + name[1:]} {
+		if !token.IsExported(n) {
+			continue
+		}
+		for v := reflect.ValueOf(val); ; v = v.Elem() {
+			if m := v.MethodByName(n); m.IsValid() {
+				return m.Interface(), true
+			}
+			if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface || v.IsNil() {
+				break
+			}
+		}
+	}
+	return nil, false
+}
+
+// callMethod calls a method without arguments
+func callMethod(m reflect.Value, name string) (interface{}, error) {
+	typ := m.Type()
+	if typ.NumIn() != 0 {
+		return nil, fmt.Errorf("method %s requires %d arguments", name, typ.NumIn())
+	}
+	if err := checkFuncType(typ); err != nil {
+		return nil, fmt.Errorf("method %s: %s", name, err)
+	}
+
+	out, err := safeCall(m, nil)
+	if err != nil {
+		return nil, fmt.Errorf("method %s: %w", name, err)
+	}
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return out[0].Interface(), nil
+}
+
+// safeCall calls fn with args. If fn panics, the panic is recovered and
+// returned as an error, so that a failing method or function stops the
+// execution of the template instead of the program executing it.
+func safeCall(fn reflect.Value, args []reflect.Value) (out []reflect.Value, err error) {
+	defer recoverPanic(&err)
+	return fn.Call(args), nil
+}
+
+// safeSeq returns seq, where a panic in seq, e.g. in an iter.Seq-function,
+// stops the iteration and is stored as an error in err
+func safeSeq(seq iter.Seq[[]interface{}], err *error) iter.Seq[[]interface{}] {
+	return func(yield func([]interface{}) bool) {
+		defer recoverPanic(err)
+		seq(yield)
+	}
+}
+
+// recoverPanic recovers a panic in a function called from a template, e.g.
+// a method or a filter, and stores it as an error in err. It must be deferred.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		if e, ok := r.(error); ok {
+			*err = fmt.Errorf("panic: %w", e)
+		} else {
+			*err = fmt.Errorf("panic: %v", r)
+		}
+	}
+}
+
+// getItem returns the element at index key of val.
+// Maps are indexed by key, converted to the key type of the map.
+// Slices, arrays and strings are indexed by integers, where negative
+// numbers count from the end. Strings are indexed by characters, not bytes.
+// For structs, key must be a string, and getItem works as getAttr.
+// Unknown keys and out of range indexes evaluate to nil.
+func getItem(val interface{}, key interface{}) (interface{}, error) {
+	res, _, err := lookupItem(val, key)
+	return res, err
+}
+
+// lookupItem works as getItem, but also reports whether the element exists
+func lookupItem(val interface{}, key interface{}) (interface{}, bool, error) {
+	v := indirect(reflect.ValueOf(val))
+	switch v.Kind() {
+	case reflect.Map:
+		k, ok := convertKey(key, v.Type().Key())
+		if !ok {
+			return nil, false, nil
+		}
+		res := v.MapIndex(k)
+		if !res.IsValid() {
+			return nil, false, nil
+		}
+		return res.Interface(), true, nil
+	case reflect.Slice, reflect.Array, reflect.String:
+		i, _, isInt, ok := toNumber(key)
+		if !ok || !isInt {
+			return nil, false, fmt.Errorf("%s indices must be integers, not %T", v.Kind(), key)
+		}
+		if v.Kind() == reflect.String {
+			runes := []rune(v.String())
+			if i < 0 {
+				i += int64(len(runes))
+			}
+			if i < 0 || i >= int64(len(runes)) {
+				return nil, false, nil
+			}
+			return string(runes[i]), true, nil
+		}
+		if i < 0 {
+			i += int64(v.Len())
+		}
+		if i < 0 || i >= int64(v.Len()) {
+			return nil, false, nil
+		}
+		return v.Index(int(i)).Interface(), true, nil
+	case reflect.Struct:
+		name, ok := toString(key)
+		if !ok {
+			return nil, false, fmt.Errorf("struct fields must be strings, not %T", key)
+		}
+		return lookupAttr(val, name)
+	}
+	return nil, false, nil
+}
+
+// convertKey converts key to a value usable as a map key of type typ
+func convertKey(key interface{}, typ reflect.Type) (reflect.Value, bool) {
+	k := reflect.ValueOf(key)
+	if !k.IsValid() {
+		return reflect.Value{}, false
+	}
+	if k.Type().AssignableTo(typ) {
+		return k, true
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		if k.Kind() == reflect.String {
+			return k.Convert(typ), true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, _, isInt, ok := toNumber(key)
+		if ok && isInt {
+			return reflect.ValueOf(i).Convert(typ), true
+		}
+	case reflect.Interface:
+		if k.Type().Implements(typ) {
+			return k, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// sliceValue returns the elements of val from low up to high, stepping by step,
+// as done by the expression 'val[low:high:step]'. Negative indexes count from the end.
+// Strings return a string, and all other types a slice of the same element type.
+func sliceValue(val interface{}, low, high, step *int64) (interface{}, error) {
+	v := indirect(reflect.ValueOf(val))
+	var length int
+	var runes []rune
+	switch v.Kind() {
+	case reflect.String:
+		runes = []rune(v.String())
+		length = len(runes)
+	case reflect.Slice, reflect.Array:
+		length = v.Len()
+	default:
+		return nil, fmt.Errorf("cannot slice %T", val)
+	}
+
+	st := int64(1)
+	if step != nil {
+		st = *step
+	}
+	if st == 0 {
+		return nil, fmt.Errorf("slice step cannot be zero")
+	}
+
+	// bound adjusts an index according to the rules of python slices
+	bound := func(p *int64, def int64) int64 {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += int64(length)
+		}
+		switch {
+		case i < 0 && st < 0:
+			return -1
+		case i < 0:
+			return 0
+		case i >= int64(length) && st < 0:
+			return int64(length) - 1
+		case i > int64(length):
+			return int64(length)
+		}
+		return i
+	}
+
+	var lo, hi int64
+	if st > 0 {
+		lo, hi = bound(low, 0), bound(high, int64(length))
+	} else {
+		lo, hi = bound(low, int64(length)-1), bound(high, -1)
+	}
+
+	var indexes []int
+	for i := lo; (st > 0 && i < hi) || (st < 0 && i > hi); i += st {
+		indexes = append(indexes, int(i))
+	}
+
+	if v.Kind() == reflect.String {
+		res := make([]rune, 0, len(indexes))
+		for _, i := range indexes {
+			res = append(res, runes[i])
+		}
+		return string(res), nil
+	}
+
+	res := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, len(indexes))
+	for _, i := range indexes {
+		res = reflect.Append(res, v.Index(i))
+	}
+	return res.Interface(), nil
+}
+
+// indirect follows pointers and interfaces until it reaches a concrete value
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isTrue reports whether val is considered true when used in a condition.
+// nil, false, zero numbers and empty strings, slices and maps are false.
+func isTrue(val interface{}) bool {
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() != 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() != 0
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return v.Len() != 0
+	}
+	return true
+}
+
+// toNumber converts val to a number. If val is an integer, isInt is set and
+// the value is returned in i, otherwise it is returned in f.
+// ok is false if val is not a number.
+func toNumber(val interface{}) (i int64, f float64, isInt bool, ok bool) {
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() {
+		return 0, 0, false, false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), float64(v.Int()), true, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// unsigned integers too large for an int64 are used as floats
+		if v.Uint() > math.MaxInt64 {
+			return 0, float64(v.Uint()), false, true
+		}
+		return int64(v.Uint()), float64(v.Uint()), true, true
+	case reflect.Float32, reflect.Float64:
+		return int64(v.Float()), v.Float(), false, true
+	}
+	return 0, 0, false, false
+}
+
+// toString returns val as a string, and reports whether it was a string
+func toString(val interface{}) (string, bool) {
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() || v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// equal reports whether a and b are equal. Numbers are compared by value,
+// regardless of their type.
+func equal(a, b interface{}) bool {
+	if ai, af, aInt, ok := toNumber(a); ok {
+		if bi, bf, bInt, ok := toNumber(b); ok {
+			if aInt && bInt {
+				return ai == bi
+			}
+			return af == bf
+		}
+		return false
+	}
+	if as, ok := toString(a); ok {
+		bs, ok := toString(b)
+		return ok && as == bs
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare compares a and b, and returns -1, 0 or 1 if a is less than, equal
+// to or greater than b. Only numbers and strings can be compared.
+func compare(a, b interface{}) (int, error) {
+	if ai, af, aInt, ok := toNumber(a); ok {
+		if bi, bf, bInt, ok := toNumber(b); ok {
+			switch {
+			case aInt && bInt && ai < bi, (!aInt || !bInt) && af < bf:
+				return -1, nil
+			case aInt && bInt && ai > bi, (!aInt || !bInt) && af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if as, ok := toString(a); ok {
+		if bs, ok := toString(b); ok {
+			return strings.Compare(as, bs), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// contains reports whether item is in container. For strings, item must be a substring
+// of container, for maps a key, and for slices and arrays an element.
+func contains(container, item interface{}) (bool, error) {
+	v := indirect(reflect.ValueOf(container))
+	if !v.IsValid() {
+		return false, fmt.Errorf("cannot check membership in nil")
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := toString(item)
+		if !ok {
+			return false, fmt.Errorf("cannot check membership of %T in string", item)
+		}
+		return strings.Contains(v.String(), s), nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if equal(v.Index(i).Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if equal(iter.Key().Interface(), item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("cannot check membership in %T", container)
+}
+
+// arithmetic applies the arithmetic operator op to a and b.
+// '+' also concatenates strings. Integer results that overflow are errors.
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if op == "+" {
+		if as, ok := toString(a); ok {
+			if bs, ok := toString(b); ok {
+				return as + bs, nil
+			}
+		}
+	}
+
+	ai, af, aInt, aOk := toNumber(a)
+	bi, bf, bInt, bOk := toNumber(b)
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("unsupported operand types for %s: %T and %T", op, a, b)
+	}
+
+	if (op == "/" || op == "//" || op == "%") && bf == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+
+	if aInt && bInt {
+		switch op {
+		case "+":
+			r := ai + bi
+			if (r > ai) != (bi > 0) {
+				return nil, overflow(op, ai, bi)
+			}
+			return r, nil
+		case "-":
+			r := ai - bi
+			if (r < ai) != (bi > 0) {
+				return nil, overflow(op, ai, bi)
+			}
+			return r, nil
+		case "*":
+			r := ai * bi
+			if ai != 0 && (r/ai != bi || ai == -1 && bi == math.MinInt64) {
+				return nil, overflow(op, ai, bi)
+			}
+			return r, nil
+		case "/":
+			return af / bf, nil
+		case "//":
+			if ai == math.MinInt64 && bi == -1 {
+				return nil, overflow(op, ai, bi)
+			}
+			q := ai / bi
+			if (ai%bi != 0) && ((ai < 0) != (bi < 0)) {
+				q--
+			}
+			return q, nil
+		case "%":
+			m := ai % bi
+			if m != 0 && ((m < 0) != (bi < 0)) {
+				m += bi
+			}
+			return m, nil
+		}
+	}
+
+	switch op {
+	case "+":
+		return af + bf, nil
+	case "-":
+		return af - bf, nil
+	case "*":
+		return af * bf, nil
+	case "/":
+		return af / bf, nil
+	case "//":
+		return math.Floor(af / bf), nil
+	case "%":
+		m := math.Mod(af, bf)
+		if m != 0 && ((m < 0) != (bf < 0)) {
+			m += bf
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+// overflow returns the error for the integer operation 'a op b' overflowing
+func overflow(op string, a, b int64) error {
+	return fmt.Errorf("integer overflow in %d %s %d", a, op, b)
+}
+
+// iterate returns the elements of val, as iterated by a for-loop, see sequence
+func iterate(val interface{}) (elements [][]interface{}, err error) {
+	seq, err := sequence(val)
+	if err != nil {
+		return nil, err
+	}
+	for element := range safeSeq(seq, &err) {
+		elements = append(elements, element)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
+
+// sequence returns a function yielding the elements of val, as iterated by a
+// for-loop. Each element is either a single value, or a pair of values for maps
+// (key and value) and iter.Seq2-functions. Maps are iterated in sorted key order.
+// Slices, arrays, strings, maps, channels and iter.Seq/iter.Seq2-functions can be
+// iterated. Channels and functions are read one element at a time as the sequence
+// is iterated, so they can be infinite if the iteration is stopped early.
+func sequence(val interface{}) (iter.Seq[[]interface{}], error) {
+	v := indirect(reflect.ValueOf(val))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return func(yield func([]interface{}) bool) {}, nil
+	case reflect.String:
+		return func(yield func([]interface{}) bool) {
+			for _, r := range v.String() {
+				if !yield([]interface{}{string(r)}) {
+					return
+				}
+			}
+		}, nil
+	case reflect.Slice, reflect.Array:
+		return func(yield func([]interface{}) bool) {
+			for i := 0; i < v.Len(); i++ {
+				if !yield([]interface{}{v.Index(i).Interface()}) {
+					return
+				}
+			}
+		}, nil
+	case reflect.Map:
+		return func(yield func([]interface{}) bool) {
+			for _, k := range sortValues(v.MapKeys()) {
+				if !yield([]interface{}{k.Interface(), v.MapIndex(k).Interface()}) {
+					return
+				}
+			}
+		}, nil
+	case reflect.Chan:
+		return func(yield func([]interface{}) bool) {
+			for {
+				x, ok := v.Recv()
+				if !ok || !yield([]interface{}{x.Interface()}) {
+					return
+				}
+			}
+		}, nil
+	case reflect.Func:
+		if v.Type().CanSeq2() {
+			return func(yield func([]interface{}) bool) {
+				for k, x := range v.Seq2() {
+					if !yield([]interface{}{k.Interface(), x.Interface()}) {
+						return
+					}
+				}
+			}, nil
+		}
+		if v.Type().CanSeq() {
+			return func(yield func([]interface{}) bool) {
+				for x := range v.Seq() {
+					if !yield([]interface{}{x.Interface()}) {
+						return
+					}
+				}
+			}, nil
+		}
+		return nil, fmt.Errorf("cannot iterate over function %s", v.Type())
+	}
+	return nil, fmt.Errorf("cannot iterate over %T", val)
+}
+
+// unpack splits val, which must be a slice or array with n elements, into separate values
+func unpack(val interface{}, n int) ([]interface{}, error) {
+	v := indirect(reflect.ValueOf(val))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot unpack %T into %d variables", val, n)
+	}
+	if v.Len() != n {
+		return nil, fmt.Errorf("cannot unpack %d values into %d variables", v.Len(), n)
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, nil
+}
+
+// sortValues sorts values in ascending order. Numbers and strings are compared
+// by value, other types by their string representation.
+func sortValues(values []reflect.Value) []reflect.Value {
+	sort.SliceStable(values, func(i, j int) bool {
+		return less(values[i].Interface(), values[j].Interface())
+	})
+	return values
+}
+
+// less reports whether a sorts before b
+func less(a, b interface{}) bool {
+	if c, err := compare(a, b); err == nil {
+		return c < 0
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// toText returns the string representation of val, as written to the output.
+// nil is converted to an empty string.
+func toText(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Markup:
+		return string(v)
+	}
+	return fmt.Sprint(val)
+}
+
+// callFunc calls the function fn with args. The function must return either
+// a single value, or a value and an error. Arguments are converted to the
+// parameter types of the function where possible, e.g. between numeric types.
+// If the last parameter of the function has the type Kwargs, the keyword
+// arguments kwargs are passed in it, otherwise kwargs must be empty.
+func callFunc(fn interface{}, args []interface{}, kwargs Kwargs) (interface{}, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%T is not callable", fn)
+	}
+	typ := v.Type()
+	if err := checkFuncType(typ); err != nil {
+		return nil, err
+	}
+
+	numIn := typ.NumIn()
+	takesKwargs := !typ.IsVariadic() && numIn > 0 && typ.In(numIn-1) == kwargsType
+	if takesKwargs {
+		numIn--
+	} else if len(kwargs) > 0 {
+		return nil, fmt.Errorf("function does not take keyword arguments")
+	}
+	if typ.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", numIn-1, len(args))
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("expected %d arguments, got %d", numIn, len(args))
+	}
+
+	in := make([]reflect.Value, len(args), len(args)+1)
+	for k, arg := range args {
+		var argType reflect.Type
+		if typ.IsVariadic() && k >= numIn-1 {
+			argType = typ.In(numIn - 1).Elem()
+		} else {
+			argType = typ.In(k)
+		}
+
+		var err error
+		in[k], err = convertArg(arg, argType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", k+1, err)
+		}
+	}
+	if takesKwargs {
+		if kwargs == nil {
+			kwargs = Kwargs{}
+		}
+		in = append(in, reflect.ValueOf(kwargs))
+	}
+
+	out, err := safeCall(v, in)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return out[0].Interface(), nil
+}
+
+// checkFuncType verifies that a function returns either a single value, or a value and an error
+func checkFuncType(typ reflect.Type) error {
+	switch {
+	case typ.NumOut() == 1:
+	case typ.NumOut() == 2 && typ.Out(1) == errorType:
+	default:
+		return fmt.Errorf("function must return a value, or a value and an error, not %d values", typ.NumOut())
+	}
+	return nil
+}
+
+// convertArg converts val to the type typ, for use as an argument to a function
+func convertArg(val interface{}, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(val)
+	if !v.IsValid() {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use nil as %s", typ)
+	}
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, _, isInt, ok := toNumber(val); ok && isInt {
+			return reflect.ValueOf(i).Convert(typ), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, f, _, ok := toNumber(val); ok {
+			return reflect.ValueOf(f).Convert(typ), nil
+		}
+	case reflect.String:
+		if s, ok := toString(val); ok {
+			return reflect.ValueOf(s).Convert(typ), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", val, typ)
+}
@@ -0,0 +1,129 @@
+package xt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type valueUser struct {
+	Name    string
+	Tags    []string
+	Profile *valueProfile
+	private string
+}
+
+type valueProfile struct {
+	City string
+}
+
+func (u valueUser) Greeting() string { return "hello " + u.Name }
+
+func TestAccess(t *testing.T) {
+	data := map[string]interface{}{
+		"user": valueUser{Name: "ann", Tags: []string{"a", "b", "c"}, Profile: &valueProfile{City: "Oslo"}, private: "x"},
+		"anon": &valueUser{Name: "bob"},
+		"m":    map[string]interface{}{"key": "value", "nested": map[string]int{"n": 1}},
+		"im":   map[int]string{1: "one"},
+		"list": []int{1, 2, 3, 4, 5},
+		"s":    "héllo",
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "field", tmpl: "{{ user.Name }}", data: data, want: "ann"},
+		{name: "lowercase field", tmpl: "{{ user.name }}", data: data, want: "ann"},
+		{name: "method", tmpl: "{{ user.Greeting }}", data: data, want: "hello ann"},
+		{name: "nested pointer", tmpl: "{{ user.profile.city }}", data: data, want: "Oslo"},
+		{name: "nil pointer field", tmpl: "[{{ anon.profile.city }}]", data: data, want: "[]"},
+		{name: "unexported field", tmpl: "[{{ user.private }}]", data: data, want: "[]"},
+		{name: "unknown attribute", tmpl: "[{{ user.missing }}]", data: data, want: "[]"},
+		{name: "map key", tmpl: "{{ m.key }} {{ m['key'] }}", data: data, want: "value value"},
+		{name: "nested map", tmpl: "{{ m.nested.n }}", data: data, want: "1"},
+		{name: "integer map key", tmpl: "{{ im[1] }} {{ im.1 }}", data: data, want: "one one"},
+		{name: "index", tmpl: "{{ list[0] }} {{ list[-1] }} {{ list.1 }}", data: data, want: "1 5 2"},
+		{name: "index out of range", tmpl: "[{{ list[10] }}]", data: data, want: "[]"},
+		{name: "index expression", tmpl: "{{ list[1 + 1] }}", data: data, want: "3"},
+		{name: "string index", tmpl: "{{ s[1] }}", data: data, want: "é"},
+		{name: "struct index", tmpl: `{{ user["Name"] }}`, data: data, want: "ann"},
+		{name: "slice", tmpl: "{{ list[1:3] }}", data: data, want: "[2 3]"},
+		{name: "open slice", tmpl: "{{ list[:2] }} {{ list[3:] }}", data: data, want: "[1 2] [4 5]"},
+		{name: "negative slice", tmpl: "{{ list[-2:] }}", data: data, want: "[4 5]"},
+		{name: "slice step", tmpl: "{{ list[::2] }} {{ list[::-1] }}", data: data, want: "[1 3 5] [5 4 3 2 1]"},
+		{name: "string slice", tmpl: "{{ s[1:3] }}", data: data, want: "él"},
+		{name: "chained", tmpl: "{{ user.Tags[1:][0] }}", data: data, want: "b"},
+		{name: "non-integer index", tmpl: `{{ list["a"] }}`, data: data, err: "indices must be integers"},
+		{name: "zero step", tmpl: "{{ list[::0] }}", data: data, err: "slice step cannot be zero"},
+		{name: "slice of number", tmpl: "{{ 5[1:] }}", err: "cannot slice"},
+		{name: "missing index", tmpl: "{{ list[] }}", data: data, err: "missing index"},
+	})
+}
+
+func (p *valueProfile) Upper() string { return p.City + "!" }
+
+func (p *valueProfile) Fail() string { panic("failed") }
+
+func TestMethodPanic(t *testing.T) {
+	data := map[string]interface{}{
+		"nilProfile": (*valueProfile)(nil),
+		"profile":    &valueProfile{City: "Oslo"},
+	}
+	runExecTests(t, NewEnvironment(), []execTest{
+		{name: "pointer method", tmpl: "{{ profile.Upper }}", data: data, want: "Oslo!"},
+		{name: "nil pointer", tmpl: "x\n  {{ nilProfile.Upper }}", data: data, err: ":2:6: method Upper: panic: runtime error: invalid memory address"},
+		{name: "panic", tmpl: "{{ profile.Fail }}", data: data, err: ":1:4: method Fail: panic: failed"},
+	})
+}
+
+func (u valueUser) Describe(prefix string, n int) string { return prefix + strings.Repeat(u.Name, n) }
+
+func TestCall(t *testing.T) {
+	env := NewEnvironment()
+	env.AddFunction("url_for", func(name string, kw Kwargs) string {
+		url := "/" + name
+		if id, ok := kw["id"]; ok {
+			url += fmt.Sprintf("/%v", id)
+		}
+		return url
+	})
+	env.AddFunction("sum", func(nums ...int) int {
+		total := 0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	})
+	env.AddFunction("half", func(n int) (int, error) {
+		if n%2 != 0 {
+			return 0, errors.New("odd number")
+		}
+		return n / 2, nil
+	})
+	env.AddFunction("explode", func() string { panic("boom") })
+	env.AddFunction("explodeErr", func() string { panic(errors.New("bad")) })
+	env.AddGlobal("upper", strings.ToUpper)
+	data := map[string]interface{}{
+		"u":       valueUser{Name: "ann"},
+		"profile": &valueProfile{City: "Oslo"},
+		"num":     3,
+	}
+	runExecTests(t, env, []execTest{
+		{name: "function", tmpl: `{{ url_for("home") }}`, want: "/home"},
+		{name: "keyword arguments", tmpl: `{{ url_for("user", id=num) }}`, data: data, want: "/user/3"},
+		{name: "variadic", tmpl: "{{ sum() }} {{ sum(1, 2, 3) }}", want: "0 6"},
+		{name: "value and error", tmpl: "{{ half(4) }}", want: "2"},
+		{name: "global function", tmpl: "{{ upper('a') }}", want: "A"},
+		{name: "method call", tmpl: "{{ u.Greeting() }}", data: data, want: "hello ann"},
+		{name: "method arguments", tmpl: "{{ u.Describe('x', 2) }}", data: data, want: "xannann"},
+		{name: "pointer method call", tmpl: "{{ profile.Upper() }}", data: data, want: "Oslo!"},
+		{name: "call in expression", tmpl: "{{ sum(1, 2) * 2 }}", want: "6"},
+		{name: "nested calls", tmpl: "{{ sum(half(4), sum(1)) }}", want: "3"},
+
+		{name: "error", tmpl: "x\n {{ half(3) }}", err: ":2:5: half: odd number"},
+		{name: "panic", tmpl: "x\n {{ explode() }}", err: ":2:5: explode: panic: boom"},
+		{name: "panic with error", tmpl: "{{ explodeErr() }}", err: ":1:4: explodeErr: panic: bad"},
+		{name: "unexpected keyword arguments", tmpl: "{{ half(2, n=2) }}", err: "half: function does not take keyword arguments"},
+		{name: "too few arguments", tmpl: "{{ half() }}", err: "half: expected 1 arguments, got 0"},
+		{name: "argument type", tmpl: "{{ half('a') }}", err: "half: argument 1: cannot use string as int"},
+		{name: "not callable", tmpl: "{{ num() }}", data: data, err: "int is not callable"},
+	})
+}